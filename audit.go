@@ -0,0 +1,347 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//Ledger keys, AUDIT_<txTimestamp>_<txId> so that a range query returns entries oldest first
+const AUDIT_KEY_PREFIX = "AUDIT_"
+const AUDIT_KEY_LAST = "~" // Sorts after every timestamp and transaction ID
+const AUDIT_TIME_FORMAT = "20060102T150405.000000000Z"
+
+//AuditOutcome
+const AO_SUCCESS = "SUCCESS"
+const AO_BLOCKED = "BLOCKED"
+
+//Payload fields that identify the entities an invocation touched
+var auditEntityFields = map[string]bool{
+	"tradeId":       true,
+	"docId":         true,
+	"participantId": true,
+	"templateId":    true,
+	"ruleId":        true,
+	"partyId":       true,
+}
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	AuditEntry - One write to the ledger. A failed invocation has all of its writes discarded, including its audit
+//				 entry, so entries record invocations that completed: SUCCESS, or BLOCKED where screening stopped
+//				 the operation and only the screening record was kept. Failures remain in the peer logs.
+//==============================================================================================================================
+type AuditEntry struct {
+	TxId            string    `json:"txId"`
+	EntryDTTM       time.Time `json:"entryDTTM"`
+	ParticipantId   string    `json:"participantId"`
+	ParticipantType string    `json:"participantType"`
+	Function        string    `json:"function"`
+	PayloadHash     string    `json:"payloadHash"`
+	EntityIds       []string  `json:"entityIds"`
+	Outcome         string    `json:"outcome"`
+}
+
+type AuditFilter struct {
+	EntityId      string    `json:"entityId"`
+	ParticipantId string    `json:"participantId"`
+	FromDTTM      time.Time `json:"fromDTTM"`
+	ToDTTM        time.Time `json:"toDTTM"`
+	Offset        int       `json:"offset"`
+	PageSize      int       `json:"pageSize"`
+}
+
+type AuditPage struct {
+	Entries    []AuditEntry `json:"entries"`
+	Total      int          `json:"total"`
+	Offset     int          `json:"offset"`
+	NextOffset int          `json:"nextOffset"`
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Audit
+//==============================================================================================================================
+//	 record_audit - Writes the audit entry for a completed invocation
+func (t *SimpleChaincode) record_audit(stub shim.ChaincodeStubInterface, caller string, function string, args []string, result []byte) error {
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return err
+	}
+
+	entry := AuditEntry{
+		TxId:          stub.GetTxID(),
+		EntryDTTM:     now,
+		ParticipantId: caller,
+		Function:      function,
+		PayloadHash:   payload_hash(function, args),
+		EntityIds:     audit_entities(args),
+		Outcome:       AO_SUCCESS,
+	}
+
+	if caller != "" {
+		party, err := t.retrieve_participant_record(stub, caller)
+
+		if err == nil {
+			entry.ParticipantType = party.Type
+		}
+	}
+
+	var screening ScreeningRecord
+
+	if result != nil && json.Unmarshal(result, &screening) == nil && screening.Outcome == SO_BLOCKED {
+		entry.Outcome = AO_BLOCKED
+	}
+
+	bytes, err := json.Marshal(entry)
+
+	if err != nil {
+		return internal_error("Error converting audit entry", err)
+	}
+
+	err = stub.PutState(audit_key(entry.EntryDTTM)+"_"+entry.TxId, bytes)
+
+	if err != nil {
+		return internal_error("Error storing audit entry", err)
+	}
+
+	return nil
+}
+
+//	 get_audit_log - Authority only. Audit entries, oldest first, filtered by entity, participant and time range.
+func (t *SimpleChaincode) get_audit_log(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, filter_json string) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var filter AuditFilter
+
+	if filter_json != "" {
+		err = json.Unmarshal([]byte(filter_json), &filter)
+
+		if err != nil {
+			return nil, invalid_argument("Invalid JSON filter provided for get_audit_log", err)
+		}
+	}
+
+	err = filter.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.PageSize == 0 {
+		filter.PageSize = DEFAULT_PAGE_SIZE
+	}
+
+	startKey, endKey := AUDIT_KEY_PREFIX, AUDIT_KEY_PREFIX+AUDIT_KEY_LAST
+
+	if !filter.FromDTTM.IsZero() {
+		startKey = audit_key(filter.FromDTTM)
+	}
+
+	if !filter.ToDTTM.IsZero() {
+		endKey = audit_key(filter.ToDTTM) + AUDIT_KEY_LAST
+	}
+
+	iter, err := stub.RangeQueryState(startKey, endKey)
+
+	if err != nil {
+		return nil, internal_error("Unable to query audit entries", err)
+	}
+
+	defer iter.Close()
+
+	page := AuditPage{Entries: []AuditEntry{}, Offset: filter.Offset, NextOffset: -1}
+
+	for iter.HasNext() {
+		key, bytes, err := iter.Next()
+
+		if err != nil {
+			return nil, internal_error("Unable to read audit entries", err)
+		}
+
+		var entry AuditEntry
+
+		err = json.Unmarshal(bytes, &entry)
+
+		if err != nil {
+			return nil, internal_error("Corrupt audit entry "+key, err)
+		}
+
+		if !filter.matches(entry) {
+			continue
+		}
+
+		if page.Total >= filter.Offset && len(page.Entries) < filter.PageSize {
+			page.Entries = append(page.Entries, entry)
+		}
+
+		page.Total++
+	}
+
+	if filter.Offset+len(page.Entries) < page.Total {
+		page.NextOffset = filter.Offset + len(page.Entries)
+	}
+
+	return json.Marshal(page)
+}
+
+//	 count_audit_entries - Used by health
+func (t *SimpleChaincode) count_audit_entries(stub shim.ChaincodeStubInterface) (int, error) {
+
+	iter, err := stub.RangeQueryState(AUDIT_KEY_PREFIX, AUDIT_KEY_PREFIX+AUDIT_KEY_LAST)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer iter.Close()
+
+	count := 0
+
+	for iter.HasNext() {
+		_, _, err = iter.Next()
+
+		if err != nil {
+			return count, err
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+//	 tx_time - The transaction's timestamp, the same on every peer, for anything written to the ledger
+func tx_time(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+
+	if err != nil {
+		return time.Time{}, internal_error("Unable to get transaction timestamp", err)
+	}
+
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+func audit_key(at time.Time) string {
+	return AUDIT_KEY_PREFIX + at.UTC().Format(AUDIT_TIME_FORMAT)
+}
+
+func (f AuditFilter) validate() error {
+	v := new_validator()
+
+	v.paging(f.Offset, f.PageSize)
+	v.check("toDTTM", f.FromDTTM.IsZero() || f.ToDTTM.IsZero() || !f.ToDTTM.Before(f.FromDTTM), "must not be before fromDTTM")
+
+	return v.result("AuditFilter")
+}
+
+func (f AuditFilter) matches(entry AuditEntry) bool {
+	if f.EntityId != "" && !contains(entry.EntityIds, f.EntityId) {
+		return false
+	}
+
+	if f.ParticipantId != "" && entry.ParticipantId != f.ParticipantId {
+		return false
+	}
+
+	if !f.FromDTTM.IsZero() && entry.EntryDTTM.Before(f.FromDTTM) {
+		return false
+	}
+
+	if !f.ToDTTM.IsZero() && entry.EntryDTTM.After(f.ToDTTM) {
+		return false
+	}
+
+	return true
+}
+
+//	 payload_hash - SHA-256 of the function and its arguments, each prefixed with its length so that different
+//					argument splits cannot hash the same
+func payload_hash(function string, args []string) string {
+	h := sha256.New()
+
+	for _, part := range append([]string{function}, args...) {
+		h.Write([]byte(strconv.Itoa(len(part)) + ":" + part))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+//	 audit_entities - IDs found in the payload: plain arguments, and the ID fields of a base64 JSON first argument
+func audit_entities(args []string) []string {
+	var ids []string
+
+	for i, arg := range args {
+		if i == 0 {
+			decoded, err := decodeBase64(arg)
+
+			var payload interface{}
+
+			if err == nil && json.Unmarshal(decoded, &payload) == nil {
+				ids = collect_entity_ids(payload, ids, 0)
+				continue
+			}
+		}
+
+		if arg != "" && !strings.ContainsAny(arg, "{[") && !contains(ids, arg) {
+			ids = append(ids, arg)
+		}
+	}
+
+	return ids
+}
+
+//	 collect_entity_ids - Walks a few levels into the payload so that wrapped objects such as {"trades": [...]} and
+//						  {"document": {...}} are covered
+func collect_entity_ids(value interface{}, ids []string, depth int) []string {
+	if depth > 3 {
+		return ids
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var keys []string
+
+		for key := range v {
+			keys = append(keys, key)
+		}
+
+		// Map order varies between peers, the entry written to the ledger must not
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			field := v[key]
+
+			if s, ok := field.(string); ok && auditEntityFields[key] && s != "" && !contains(ids, s) {
+				ids = append(ids, s)
+			} else {
+				ids = collect_entity_ids(field, ids, depth+1)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			ids = collect_entity_ids(item, ids, depth+1)
+		}
+	}
+
+	return ids
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//Ledger keys
+const MK_OVERSIGHT = "KEY_OVERSIGHT"
+const OVERSIGHT_KEY_PREFIX = "OVERSIGHT_"
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	Authority - A regulator. Authorities can read every trade, place and lift holds and manage reference data.
+//==============================================================================================================================
+type Authority struct {
+	Participant
+	Jurisdiction string `json:"jurisdiction"`
+	Mandate      string `json:"mandate"`
+}
+
+type TradeHold struct {
+	HoldId      string    `json:"holdId"`
+	Reason      string    `json:"reason"`
+	PlacedBy    string    `json:"placedBy"`
+	PlacedDTTM  time.Time `json:"placedDTTM"`
+	LiftedBy    string    `json:"liftedBy"`
+	LiftedDTTM  time.Time `json:"liftedDTTM"`
+	LiftReason  string    `json:"liftReason"`
+	IsActive    bool      `json:"isActive"`
+	PlacedTxnId string    `json:"placedTxnId"`
+}
+
+type OversightEntry struct {
+	EntryId     string    `json:"entryId"`
+	AuthorityId string    `json:"authorityId"`
+	Action      string    `json:"action"`
+	EntityId    string    `json:"entityId"`
+	Detail      string    `json:"detail"`
+	ActionDTTM  time.Time `json:"actionDTTM"`
+}
+
+type Oversight_Holder struct {
+	EntryId []string `json:"entryIdList"`
+}
+
+//==============================================================================================================================
+//	 Interface Methods
+//==============================================================================================================================
+func (p Authority) getType() string {
+	return p.Type
+}
+
+func (p Authority) getId() string {
+	return p.ParticipantID
+}
+
+func (party Authority) validate() error {
+	v := new_validator()
+
+	v.nested("", party.Participant.validate())
+	v.check("type", party.Type == PT_AUTHORITY, "must be "+PT_AUTHORITY)
+	v.text("jurisdiction", party.Jurisdiction, MAX_NAME_LENGTH)
+
+	return v.result("Authority")
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Authority
+//==============================================================================================================================
+//	 check_authority_registration - The first authority is seeded by Init, every later one must be registered by an
+//									existing authority.
+func (t *SimpleChaincode) check_authority_registration(stub shim.ChaincodeStubInterface, caller string) error {
+	return t.check_caller_type(stub, caller, PT_AUTHORITY)
+}
+
+//	 seed_authority - Registers the first authority from the argument given to Init, so that the network is never
+//					  without one and no caller can claim the role by registering first.
+func (t *SimpleChaincode) seed_authority(stub shim.ChaincodeStubInterface, authority_json []byte) error {
+
+	participant, err := createParticipantFactory(authority_json, PT_AUTHORITY)
+
+	if err != nil {
+		return wrap_error(err, "Invalid JSON object provided for the first authority")
+	}
+
+	err = participant.validate()
+
+	if err != nil {
+		return err
+	}
+
+	err = t.validate_country(stub, participant.getParticipant().Country)
+
+	if err != nil {
+		return err
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return err
+	}
+
+	authority_json, err = set_participant_fields(authority_json, map[string]interface{}{
+		"status": PS_ACTIVE, "statusReason": "", "statusDTTM": now, "kyc": nil})
+
+	if err != nil {
+		return invalid_argument("Invalid JSON object provided for the first authority", err)
+	}
+
+	_, err = t.save_participant(stub, authority_json, participant.getId())
+
+	if err != nil {
+		return err
+	}
+
+	var participants Participant_Holder
+
+	err = t.get_holder(stub, MK_PARTICIPANT, &participants)
+
+	if err != nil {
+		return err
+	}
+
+	participants.ParticipantId = append(participants.ParticipantId, participant.getId())
+
+	return t.put_holder(stub, MK_PARTICIPANT, participants)
+}
+
+//	 is_authority - True if the caller is a registered authority
+func (t *SimpleChaincode) is_authority(stub shim.ChaincodeStubInterface, caller string) bool {
+	return t.check_caller_type(stub, caller, PT_AUTHORITY) == nil
+}
+
+//	 record_oversight - Appends an entry to the oversight log. Called by every authority-only invoke.
+func (t *SimpleChaincode) record_oversight(stub shim.ChaincodeStubInterface, caller string, action string, entityId string, detail string) error {
+
+	var holder Oversight_Holder
+
+	err := t.get_holder(stub, MK_OVERSIGHT, &holder)
+
+	if err != nil {
+		return err
+	}
+
+	var entry OversightEntry
+
+	entry.EntryId = OVERSIGHT_KEY_PREFIX + stub.GetTxID() + "_" + strconv.Itoa(len(holder.EntryId))
+	entry.AuthorityId = caller
+	entry.Action = action
+	entry.EntityId = entityId
+	entry.Detail = detail
+	entry.ActionDTTM, err = tx_time(stub)
+
+	if err != nil {
+		return err
+	}
+
+	bytes, err := json.Marshal(entry)
+
+	if err != nil {
+		return internal_error("Error converting oversight entry", err)
+	}
+
+	err = stub.PutState(entry.EntryId, bytes)
+
+	if err != nil {
+		fmt.Printf("RECORD_OVERSIGHT: Error storing oversight entry: %s", err)
+		return internal_error("Error storing oversight entry", err)
+	}
+
+	holder.EntryId = append(holder.EntryId, entry.EntryId)
+
+	return t.put_holder(stub, MK_OVERSIGHT, holder)
+}
+
+//	 get_oversight_log - Authority only. Optionally filtered by entity.
+func (t *SimpleChaincode) get_oversight_log(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, entityId string) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var holder Oversight_Holder
+
+	err = t.get_holder(stub, MK_OVERSIGHT, &holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []OversightEntry{}
+
+	for _, entryId := range holder.EntryId {
+		bytes, err := stub.GetState(entryId)
+
+		if err != nil || bytes == nil {
+			return nil, wrap_error(err, "Failed to retrieve oversight entry "+entryId)
+		}
+
+		var entry OversightEntry
+
+		err = json.Unmarshal(bytes, &entry)
+
+		if err != nil {
+			return nil, internal_error("Corrupt oversight entry "+entryId, err)
+		}
+
+		if entityId == "" || entry.EntityId == entityId {
+			entries = append(entries, entry)
+		}
+	}
+
+	return json.Marshal(entries)
+}
+
+//	 place_hold - Authority only. A trade with an active hold cannot change state, take documents or enrol participants.
+func (t *SimpleChaincode) place_hold(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, tradeId string, reason string) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if reason == "" {
+		return nil, validation_error("place_hold: A reason is required")
+	}
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "place_hold: Failed to retrieve Trade")
+	}
+
+	var hold TradeHold
+
+	hold.HoldId = tradeId + "_HOLD_" + strconv.Itoa(len(v.Holds)+1)
+	hold.Reason = reason
+	hold.PlacedBy = caller
+	hold.PlacedDTTM, err = tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hold.PlacedTxnId = stub.GetTxID()
+	hold.IsActive = true
+
+	v.Holds = append(v.Holds, hold)
+
+	_, err = t.save_trade(stub, v)
+
+	if err != nil {
+		fmt.Printf("place_hold: Error saving changes: %s", err)
+		return nil, internal_error("place_hold: Error saving changes", err)
+	}
+
+	err = t.record_oversight(stub, caller, "place_hold", tradeId, hold.HoldId+": "+reason)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(hold.HoldId), nil
+}
+
+//	 lift_hold - Authority only
+func (t *SimpleChaincode) lift_hold(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, tradeId string, holdId string, reason string) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if reason == "" {
+		return nil, validation_error("lift_hold: A reason is required")
+	}
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "lift_hold: Failed to retrieve Trade")
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+
+	for i := range v.Holds {
+		if v.Holds[i].HoldId == holdId && v.Holds[i].IsActive {
+			v.Holds[i].IsActive = false
+			v.Holds[i].LiftedBy = caller
+			v.Holds[i].LiftedDTTM = now
+			v.Holds[i].LiftReason = reason
+			found = true
+		}
+	}
+
+	if !found {
+		return nil, invalid_state("lift_hold: No active hold " + holdId + " on trade " + tradeId)
+	}
+
+	_, err = t.save_trade(stub, v)
+
+	if err != nil {
+		fmt.Printf("lift_hold: Error saving changes: %s", err)
+		return nil, internal_error("lift_hold: Error saving changes", err)
+	}
+
+	return nil, t.record_oversight(stub, caller, "lift_hold", tradeId, holdId+": "+reason)
+}
+
+//	 check_not_on_hold
+func check_not_on_hold(v Trade) error {
+	for _, hold := range v.Holds {
+		if hold.IsActive {
+			return invalid_state("Trade " + v.TradeId + " is on hold: " + hold.Reason)
+		}
+	}
+	return nil
+}
+
+//	 can_read_trade - Authorities read every trade, other callers only the trades they are enrolled on. A caller
+//					  that is not identified reads none.
+func (t *SimpleChaincode) can_read_trade(stub shim.ChaincodeStubInterface, v Trade, caller string) bool {
+
+	if caller == "" {
+		return false
+	}
+
+	if t.is_authority(stub, caller) {
+		return true
+	}
+
+	for _, tp := range v.Participants {
+		if tp.ParticipantID == caller {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//Ledger key for the required-document rules
+const MK_DOC_RULE = "KEY_DOC_RULE"
+
+//Rules in force until an authority changes them
+var defaultDocumentRules = []DocumentRule{
+	{RuleId: "DR-INVOICE", State: WS_TRADE_DECLARED, DocType: DT_SMRY_INVOICE, Description: "Commercial invoice before declaration"},
+	{RuleId: "DR-PACKING", State: WS_TRADE_DECLARED, DocType: DT_PACKING_LIST, Description: "Packing list before declaration"},
+	{RuleId: "DR-ORIGIN", State: WS_TRADE_DECLARED, DocType: DT_CERT_ORIGIN, PreferenceClaimed: true, Verified: true,
+		Description: "Verified certificate of origin when preferential duty is claimed"},
+}
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	DocumentRule - A document type that must be attached, and if Verified is set verified, before a trade moves to
+//				   State. Empty country and HS prefix fields match any trade; PreferenceClaimed limits the rule to
+//				   trades with a goods line claiming preferential duty. Owner is the relationship that owes the
+//				   document and defaults to the party the Incoterm assigns it to, or the exporter.
+//==============================================================================================================================
+type DocumentRule struct {
+	RuleId             string `json:"ruleId"`
+	State              string `json:"state"`
+	DocType            string `json:"docType"`
+	Owner              string `json:"owner"`
+	OriginCountry      string `json:"originCountry"`
+	DestinationCountry string `json:"destinationCountry"`
+	HSPrefix           string `json:"hsPrefix"`
+	PreferenceClaimed  bool   `json:"preferenceClaimed"`
+	Verified           bool   `json:"verified"`
+	Description        string `json:"description"`
+}
+
+type DocumentRule_Holder struct {
+	Rules []DocumentRule `json:"rules"`
+}
+
+type ChecklistItem struct {
+	RuleId      string   `json:"ruleId"`
+	State       string   `json:"state"`
+	DocType     string   `json:"docType"`
+	Description string   `json:"description"`
+	Owner       string   `json:"owner"`
+	OwedBy      []string `json:"owedBy"`
+	DocId       string   `json:"docId"`
+	Verified    bool     `json:"verified"`
+	NeedsVerify bool     `json:"needsVerification"`
+	Outstanding bool     `json:"outstanding"`
+}
+
+//	TradeChecklist - Returned by get_trade_checklist
+type TradeChecklist struct {
+	TradeId     string          `json:"tradeId"`
+	Outstanding int             `json:"outstanding"`
+	Items       []ChecklistItem `json:"items"`
+}
+
+//==============================================================================================================================
+//	 Validation
+//==============================================================================================================================
+func (r DocumentRule) validate() error {
+	v := new_validator()
+
+	v.identifier("ruleId", r.RuleId)
+	v.required("state", r.State)
+	v.one_of("state", r.State, tradeStates...)
+	v.required("docType", r.DocType)
+	v.one_of("docType", r.DocType, documentTypes...)
+	v.format("hsPrefix", r.HSPrefix, is_digits(normalise_hs_code(r.HSPrefix)), "digits")
+	v.max_length("description", r.Description, MAX_TEXT_LENGTH)
+
+	return v.result("DocumentRule")
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Document Rules
+//==============================================================================================================================
+func (t *SimpleChaincode) add_document_rule(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, json_data []byte) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rule DocumentRule
+
+	err = json.Unmarshal(json_data, &rule)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for add_document_rule", err)
+	}
+
+	err = rule.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.resolve_rule_countries(stub, &rule)
+
+	if err != nil {
+		return nil, wrap_error(err, "add_document_rule")
+	}
+
+	holder, err := t.retrieve_document_rules(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, existing := range holder.Rules {
+		if existing.RuleId == rule.RuleId {
+			return nil, conflict("Document rule already exists")
+		}
+	}
+
+	holder.Rules = append(holder.Rules, rule)
+
+	err = t.put_holder(stub, MK_DOC_RULE, holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, t.record_oversight(stub, caller, "add_document_rule", rule.RuleId, rule.Description)
+}
+
+func (t *SimpleChaincode) remove_document_rule(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, ruleId string) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	holder, err := t.retrieve_document_rules(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, existing := range holder.Rules {
+		if existing.RuleId == ruleId {
+			holder.Rules = append(holder.Rules[:i], holder.Rules[i+1:]...)
+
+			err = t.put_holder(stub, MK_DOC_RULE, holder)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return nil, t.record_oversight(stub, caller, "remove_document_rule", ruleId, "")
+		}
+	}
+
+	return nil, not_found("remove_document_rule: Unknown document rule " + ruleId)
+}
+
+//	 resolve_rule_countries - Stores the corridor of a rule as alpha-2 codes
+func (t *SimpleChaincode) resolve_rule_countries(stub shim.ChaincodeStubInterface, rule *DocumentRule) error {
+
+	for _, code := range []*string{&rule.OriginCountry, &rule.DestinationCountry} {
+		if *code == "" {
+			continue
+		}
+
+		c, err := t.retrieve_country(stub, *code)
+
+		if err != nil {
+			return err
+		}
+
+		*code = c.Alpha2
+	}
+
+	return nil
+}
+
+//	 retrieve_document_rules - The default rules apply until the rules have first been written
+func (t *SimpleChaincode) retrieve_document_rules(stub shim.ChaincodeStubInterface) (DocumentRule_Holder, error) {
+
+	var holder DocumentRule_Holder
+
+	bytes, err := stub.GetState(MK_DOC_RULE)
+
+	if err != nil {
+		return holder, internal_error("Unable to get MK_DOC_RULE", err)
+	}
+
+	if bytes == nil {
+		holder.Rules = append(holder.Rules, defaultDocumentRules...)
+		return holder, nil
+	}
+
+	err = json.Unmarshal(bytes, &holder)
+
+	if err != nil {
+		return holder, internal_error("Corrupt document rules", err)
+	}
+
+	return holder, nil
+}
+
+// get_document_rules
+func (t *SimpleChaincode) get_document_rules(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	holder, err := t.retrieve_document_rules(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(holder)
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Checklist
+//==============================================================================================================================
+//	 verify_trade_document - Customs enrolled on the trade, or an authority, confirms an attached document. The
+//							 participant that attached it cannot verify it.
+func (t *SimpleChaincode) verify_trade_document(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, tradeId string, docId string) ([]byte, error) {
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "verify_trade_document: Failed to retrieve Trade")
+	}
+
+	isCustoms := is_enrolled_as(v, caller, TR_SRC_CUSTOMS) || is_enrolled_as(v, caller, TR_DST_CUSTOMS)
+
+	if !t.is_authority(stub, caller) && (!isCustoms || check_acting_participant(v, caller) != nil) {
+		return nil, permission_denied("verify_trade_document: Only customs on the trade or an authority may verify documents")
+	}
+
+	for i := range v.Docs {
+		if v.Docs[i].DocId != docId {
+			continue
+		}
+
+		if v.Docs[i].AddedBy == caller {
+			return nil, permission_denied("verify_trade_document: A participant cannot verify a document it attached")
+		}
+
+		v.Docs[i].Verified = DS_VERIFIED
+		v.Docs[i].VerifiedBy = caller
+		v.Docs[i].VerifiedDTTM, err = tx_time(stub)
+
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = t.save_trade(stub, v)
+
+		if err != nil {
+			fmt.Printf("verify_trade_document: Error saving changes: %s", err)
+			return nil, internal_error("verify_trade_document: Error saving changes", err)
+		}
+
+		return nil, nil
+	}
+
+	return nil, not_found("verify_trade_document: Document " + docId + " is not attached to trade " + tradeId)
+}
+
+//	 get_trade_checklist - Every document the trade needs for its coming transitions, what is outstanding and which
+//						   participants owe it
+func (t *SimpleChaincode) get_trade_checklist(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, tradeId string) ([]byte, error) {
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "Failed to retrieve Trade")
+	}
+
+	if !t.can_read_trade(stub, v, caller) {
+		return nil, permission_denied("Caller " + caller + " is not permitted to read trade " + tradeId)
+	}
+
+	items, err := t.trade_checklist(stub, v, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := TradeChecklist{TradeId: tradeId, Items: items}
+
+	for _, item := range items {
+		if item.Outstanding {
+			result.Outstanding++
+		}
+	}
+
+	return json.Marshal(result)
+}
+
+//	 check_document_checklist - Refuses a transition while documents required for it are outstanding
+func (t *SimpleChaincode) check_document_checklist(stub shim.ChaincodeStubInterface, v Trade, state string) error {
+
+	items, err := t.trade_checklist(stub, v, state)
+
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+
+	for _, item := range items {
+		if item.Outstanding {
+			missing = append(missing, item.DocType+" from "+item.Owner)
+		}
+	}
+
+	if len(missing) > 0 {
+		return invalid_state("Trade " + v.TradeId + " cannot move to " + state + ", outstanding documents: " + strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+//	 trade_checklist - The checklist items of the general rules and the trade's own rules that apply to the trade,
+//					   for one state or all states if state is empty. Insurance the Incoterm obliges a party to take
+//					   out is required before declaration.
+func (t *SimpleChaincode) trade_checklist(stub shim.ChaincodeStubInterface, v Trade, state string) ([]ChecklistItem, error) {
+
+	holder, err := t.retrieve_document_rules(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rules := append(holder.Rules, v.RequiredDocs...)
+
+	if v.Incoterm != nil && incoterms[v.Incoterm.Code].Insurance != "" {
+		rules = append(rules, DocumentRule{RuleId: "INCOTERM-" + v.Incoterm.Code, State: WS_TRADE_DECLARED, DocType: DT_INSURANCE_CERT,
+			Description: "Insurance required under " + v.Incoterm.Code})
+	}
+
+	_, pair, err := t.screen_trade_participants(stub, active_participants(v))
+
+	if err != nil {
+		return nil, err
+	}
+
+	origin, destination := "", ""
+
+	if pair != nil {
+		origin, destination = pair[0], pair[1]
+	}
+
+	var items []ChecklistItem
+
+	for _, rule := range rules {
+		if (state != "" && rule.State != state) || !rule_applies(rule, v, origin, destination) {
+			continue
+		}
+
+		item := ChecklistItem{RuleId: rule.RuleId, State: rule.State, DocType: rule.DocType, Description: rule.Description,
+			Owner: document_owner(v, rule), NeedsVerify: rule.Verified}
+
+		for _, tp := range active_participants(v) {
+			if tp.RelationshipType == item.Owner && !contains(item.OwedBy, tp.ParticipantID) {
+				item.OwedBy = append(item.OwedBy, tp.ParticipantID)
+			}
+		}
+
+		for _, d := range v.Docs {
+			docType, err := t.retrieve_document_type(stub, d.DocId)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if docType != rule.DocType || (item.DocId != "" && (item.Verified || !d.Verified)) {
+				continue
+			}
+
+			item.DocId = d.DocId
+			item.Verified = d.Verified
+		}
+
+		item.Outstanding = item.DocId == "" || (rule.Verified && !item.Verified)
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+func rule_applies(rule DocumentRule, v Trade, origin string, destination string) bool {
+	if (rule.OriginCountry != "" && rule.OriginCountry != origin) || (rule.DestinationCountry != "" && rule.DestinationCountry != destination) {
+		return false
+	}
+
+	if rule.HSPrefix == "" && !rule.PreferenceClaimed {
+		return true
+	}
+
+	for _, g := range v.Goods {
+		if (rule.HSPrefix == "" || strings.HasPrefix(normalise_hs_code(g.HSCode), normalise_hs_code(rule.HSPrefix))) &&
+			(!rule.PreferenceClaimed || g.PreferenceClaimed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//	 document_owner - The relationship that owes the document for the rule
+func document_owner(v Trade, rule DocumentRule) string {
+	if rule.Owner != "" {
+		return rule.Owner
+	}
+
+	if v.Incoterm != nil {
+		for _, d := range incoterms[v.Incoterm.Code].documents() {
+			if d.DocType == rule.DocType {
+				return d.RelationshipType
+			}
+		}
+	}
+
+	return SELLER
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//Ledger key prefix for the trades each container has been used on
+const CONTAINER_KEY_PREFIX = "CONTAINER_"
+
+//ISO 6346 equipment category identifiers: freight container, detachable equipment, trailer
+const ISO6346_CATEGORIES = "UJZ"
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	Container - Equipment the goods of a trade travel in. Status is the last port event recorded for it and
+//				History every status it has had on this trade.
+//==============================================================================================================================
+type Container struct {
+	ContainerNo string                `json:"containerNo"`
+	SizeType    string                `json:"sizeType"`
+	Seals       []string              `json:"seals"`
+	Allocations []ContainerAllocation `json:"allocations"`
+	Status      string                `json:"status"`
+	StatusPort  string                `json:"statusPort"`
+	StatusDTTM  time.Time             `json:"statusDTTM"`
+	History     []ContainerStatus     `json:"history"`
+}
+
+//	ContainerAllocation - How much of a goods line is packed in the container
+type ContainerAllocation struct {
+	LineNum  int   `json:"lineNum"`
+	Quantity int64 `json:"quantity"`
+}
+
+type ContainerStatus struct {
+	Status     string    `json:"status"`
+	Port       string    `json:"port"`
+	StatusDTTM time.Time `json:"statusDTTM"`
+}
+
+type ContainerTrades struct {
+	ContainerNo string   `json:"containerNo"`
+	TradeIds    []string `json:"tradeIds"`
+}
+
+//	ContainerTrade - Returned by get_trade_for_container. TradeId is the trade the container is on now and TradeIds
+//					 every trade it has been on.
+type ContainerTrade struct {
+	TradeId   string    `json:"tradeId"`
+	Container Container `json:"container"`
+	TradeIds  []string  `json:"tradeIds"`
+}
+
+//==============================================================================================================================
+//	 Validation
+//==============================================================================================================================
+func (c Container) validate() error {
+	v := new_validator()
+
+	v.required("containerNo", c.ContainerNo)
+	v.format("containerNo", c.ContainerNo, is_valid_container_no(c.ContainerNo), "an ISO 6346 number with a valid check digit")
+	v.required("sizeType", c.SizeType)
+	v.format("sizeType", c.SizeType, len(c.SizeType) == 4 && is_upper_alphanumeric(c.SizeType), "a 4 character ISO 6346 code")
+
+	seen := make(map[string]bool)
+
+	for i, seal := range c.Seals {
+		v.required(index_field("seals", i), seal)
+		v.check(index_field("seals", i), seal == "" || !seen[seal], "must be unique")
+		seen[seal] = true
+	}
+
+	for i, a := range c.Allocations {
+		v.positive(index_field("allocations", i)+".lineNum", int64(a.LineNum))
+		v.positive(index_field("allocations", i)+".quantity", a.Quantity)
+	}
+
+	return v.result("Container " + c.ContainerNo)
+}
+
+//	 check_container_allocations - Allocations must refer to goods lines of the trade and not pack more of a line than
+//								   the trade carries.
+func check_container_allocations(v Trade) error {
+	quantities := make(map[int]int64)
+
+	for _, g := range v.Goods {
+		quantities[g.LineNum] = g.Quantity
+	}
+
+	for _, c := range v.Containers {
+		for _, a := range c.Allocations {
+			remaining, found := quantities[a.LineNum]
+
+			if !found {
+				return validation_error("Container " + c.ContainerNo + " is allocated goods line " + strconv.Itoa(a.LineNum) + " which is not on the trade")
+			}
+
+			if a.Quantity > remaining {
+				return validation_error("Goods line " + strconv.Itoa(a.LineNum) + " is allocated more than its quantity across containers")
+			}
+
+			quantities[a.LineNum] = remaining - a.Quantity
+		}
+	}
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Containers
+//==============================================================================================================================
+//	 set_trade_containers - Sets the containers of a trade. Containers that already have port events keep their status
+//							and cannot be dropped, and only customs or an authority may change their seals.
+func (t *SimpleChaincode) set_trade_containers(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, json_data []byte, tradeId string) ([]byte, error) {
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "set_trade_containers: Failed to retrieve Trade")
+	}
+
+	err = check_not_on_hold(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.check_trade_screening(stub, v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !t.is_authority(stub, caller) && check_acting_participant(v, caller) != nil {
+		return nil, permission_denied("Caller " + caller + " may not change the containers of trade " + tradeId)
+	}
+
+	var containers []Container
+
+	err = json.Unmarshal(json_data, &containers)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for set_trade_containers", err)
+	}
+
+	mayReseal := t.is_authority(stub, caller) || t.check_caller_type(stub, caller, PT_CUSTOMS) == nil
+
+	seen := make(map[string]bool)
+
+	for i := range containers {
+		c := &containers[i]
+
+		c.ContainerNo = normalise_container_no(c.ContainerNo)
+		c.SizeType = strings.ToUpper(c.SizeType)
+
+		err = c.validate()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[c.ContainerNo] {
+			return nil, conflict("set_trade_containers: Container " + c.ContainerNo + " is listed twice")
+		}
+		seen[c.ContainerNo] = true
+
+		c.Status, c.StatusPort, c.StatusDTTM, c.History = "", "", time.Time{}, nil
+
+		j := find_container(v, c.ContainerNo)
+
+		if j < 0 {
+			continue
+		}
+
+		old := v.Containers[j]
+
+		if old.Status != "" && !mayReseal && strings.Join(old.Seals, ",") != strings.Join(c.Seals, ",") {
+			return nil, invalid_state("set_trade_containers: Seals of container " + c.ContainerNo + " can only be changed by customs once it is moving")
+		}
+
+		c.Status, c.StatusPort, c.StatusDTTM, c.History = old.Status, old.StatusPort, old.StatusDTTM, old.History
+	}
+
+	for _, old := range v.Containers {
+		if old.Status != "" && !seen[old.ContainerNo] {
+			return nil, invalid_state("set_trade_containers: Container " + old.ContainerNo + " has port events and cannot be removed")
+		}
+	}
+
+	previous := v.Containers
+	v.Containers = containers
+
+	err = check_container_allocations(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = t.save_trade(stub, v)
+
+	if err != nil {
+		fmt.Printf("set_trade_containers: Error saving changes: %s", err)
+		return nil, internal_error("set_trade_containers: Error saving changes", err)
+	}
+
+	for _, old := range previous {
+		if !seen[old.ContainerNo] {
+			err = t.index_container_trade(stub, old.ContainerNo, tradeId, false)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, c := range containers {
+		err = t.index_container_trade(stub, c.ContainerNo, tradeId, true)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+//	 index_container_trade - Adds or removes the trade from the container's index. Trades are kept in the order the
+//							 container was put on them, so the last is the container's current trade.
+func (t *SimpleChaincode) index_container_trade(stub shim.ChaincodeStubInterface, containerNo string, tradeId string, add bool) error {
+
+	index, err := t.retrieve_container_trades(stub, containerNo)
+
+	if err != nil {
+		return err
+	}
+
+	if add == contains(index.TradeIds, tradeId) {
+		return nil
+	}
+
+	if add {
+		index.TradeIds = append(index.TradeIds, tradeId)
+	} else {
+		index.TradeIds = remove(index.TradeIds, tradeId)
+	}
+
+	bytes, err := json.Marshal(index)
+
+	if err != nil {
+		return internal_error("Error converting container index for "+containerNo, err)
+	}
+
+	err = stub.PutState(CONTAINER_KEY_PREFIX+containerNo, bytes)
+
+	if err != nil {
+		return internal_error("Error storing container index for "+containerNo, err)
+	}
+
+	return nil
+}
+
+func (t *SimpleChaincode) retrieve_container_trades(stub shim.ChaincodeStubInterface, containerNo string) (ContainerTrades, error) {
+
+	index := ContainerTrades{ContainerNo: containerNo}
+
+	bytes, err := stub.GetState(CONTAINER_KEY_PREFIX + containerNo)
+
+	if err != nil {
+		return index, internal_error("Unable to get container index for "+containerNo, err)
+	}
+
+	if bytes == nil {
+		return index, nil
+	}
+
+	err = json.Unmarshal(bytes, &index)
+
+	if err != nil {
+		return index, internal_error("Corrupt container index for "+containerNo, err)
+	}
+
+	return index, nil
+}
+
+//	 get_trade_for_container - The trade a container is currently on, its status there and the earlier trades it was
+//							   used on
+func (t *SimpleChaincode) get_trade_for_container(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, containerNo string) ([]byte, error) {
+
+	containerNo = normalise_container_no(containerNo)
+
+	index, err := t.retrieve_container_trades(stub, containerNo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(index.TradeIds) == 0 {
+		return nil, not_found("Container " + containerNo + " is not on any trade")
+	}
+
+	tradeId := index.TradeIds[len(index.TradeIds)-1]
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "Failed to retrieve Trade "+tradeId)
+	}
+
+	if !t.can_read_trade(stub, v, caller) {
+		return nil, permission_denied("Caller " + caller + " is not permitted to read trade " + tradeId)
+	}
+
+	result := ContainerTrade{tradeId, v.Containers[find_container(v, containerNo)], index.TradeIds}
+
+	return json.Marshal(result)
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+func (c *Container) setStatus(status string, port string, at time.Time) {
+	c.Status = status
+	c.StatusPort = port
+	c.StatusDTTM = at
+	c.History = append(c.History, ContainerStatus{Status: status, Port: port, StatusDTTM: at})
+}
+
+func find_container(v Trade, containerNo string) int {
+	for i, c := range v.Containers {
+		if c.ContainerNo == containerNo {
+			return i
+		}
+	}
+	return -1
+}
+
+func normalise_container_no(containerNo string) string {
+	return strings.ToUpper(strings.Replace(strings.Replace(containerNo, " ", "", -1), "-", "", -1))
+}
+
+//	 is_valid_container_no - ISO 6346: three letter owner code, category U, J or Z, six digit serial and a check digit.
+//							 Letters count from A=10 skipping multiples of 11, each character is weighted by 2^position
+//							 and the check digit is the sum mod 11, with 10 written as 0.
+func is_valid_container_no(containerNo string) bool {
+	if len(containerNo) != 11 || !strings.ContainsRune(ISO6346_CATEGORIES, rune(containerNo[3])) {
+		return false
+	}
+
+	sum := 0
+
+	for i := 0; i < 10; i++ {
+		ch := containerNo[i]
+		value := 0
+
+		switch {
+		case i < 4 && ch >= 'A' && ch <= 'Z':
+			value = int(ch-'A') + 10
+			value += (value - 1) / 10
+		case i >= 4 && ch >= '0' && ch <= '9':
+			value = int(ch - '0')
+		default:
+			return false
+		}
+
+		sum += value << uint(i)
+	}
+
+	check := containerNo[10]
+
+	return check >= '0' && check <= '9' && sum%11%10 == int(check-'0')
+}
+
+func is_upper_alphanumeric(s string) bool {
+	for _, r := range s {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//Ledger keys
+const MK_COUNTRY = "KEY_COUNTRY"
+const MK_COUNTRY_MIGRATION = "KEY_COUNTRY_MIGRATION"
+const COUNTRY_KEY_PREFIX = "COUNTRY_"
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	Country - ISO 3166-1 country reference data. LegacyCode holds the CT_* value the country was known by before
+//			  the registry existed so records created with those values still resolve.
+//==============================================================================================================================
+type Country struct {
+	Alpha2        string   `json:"alpha2"`
+	Alpha3        string   `json:"alpha3"`
+	Name          string   `json:"name"`
+	CustomsUnions []string `json:"customsUnions"`
+	HighRisk      bool     `json:"highRisk"`
+	LegacyCode    string   `json:"legacyCode"`
+}
+
+type Country_Holder struct {
+	Alpha2 []string `json:"alpha2List"`
+}
+
+//	legacyCountries - One-time mapping of the CT_* constants onto the registry
+var legacyCountries = []Country{
+	{Alpha2: "AE", Alpha3: "ARE", Name: "United Arab Emirates", CustomsUnions: []string{"GCC"}, LegacyCode: CT_UAE},
+	{Alpha2: "CN", Alpha3: "CHN", Name: "China", CustomsUnions: []string{}, LegacyCode: CT_CHINA},
+	{Alpha2: "IN", Alpha3: "IND", Name: "India", CustomsUnions: []string{}, LegacyCode: CT_INDIA},
+	{Alpha2: "US", Alpha3: "USA", Name: "United States of America", CustomsUnions: []string{}, LegacyCode: CT_USA},
+	{Alpha2: "GB", Alpha3: "GBR", Name: "United Kingdom", CustomsUnions: []string{}, LegacyCode: CT_UK},
+}
+
+//==============================================================================================================================
+//	 Validation
+//==============================================================================================================================
+func (c Country) validate() error {
+	v := new_validator()
+
+	v.required("alpha2", c.Alpha2)
+	v.format("alpha2", c.Alpha2, len(c.Alpha2) == 2 && is_upper_alpha(c.Alpha2), "2 upper case letters")
+	v.required("alpha3", c.Alpha3)
+	v.format("alpha3", c.Alpha3, len(c.Alpha3) == 3 && is_upper_alpha(c.Alpha3), "3 upper case letters")
+	v.text("name", c.Name, MAX_NAME_LENGTH)
+
+	return v.result("Country")
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Country Entity
+//==============================================================================================================================
+//	 save_country_reference - Adds a country or replaces its reference data. Authority only.
+func (t *SimpleChaincode) save_country_reference(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, json_data []byte) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var c Country
+
+	err = json.Unmarshal(json_data, &c)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for save_country_reference", err)
+	}
+
+	err = c.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := t.retrieve_country(stub, c.Alpha3)
+
+	if err == nil && existing.Alpha2 != c.Alpha2 {
+		return nil, conflict("Alpha-3 code " + c.Alpha3 + " already belongs to " + existing.Alpha2)
+	}
+
+	err = t.save_country(stub, c)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, t.record_oversight(stub, caller, "save_country_reference", c.Alpha2, c.Name)
+}
+
+func (t *SimpleChaincode) save_country(stub shim.ChaincodeStubInterface, c Country) error {
+
+	bytes, err := json.Marshal(c)
+
+	if err != nil {
+		fmt.Printf("SAVE_COUNTRY: Error converting country record: %s", err)
+		return internal_error("Error converting country record", err)
+	}
+
+	err = stub.PutState(COUNTRY_KEY_PREFIX+c.Alpha2, bytes)
+
+	if err != nil {
+		fmt.Printf("SAVE_COUNTRY: Error storing country record: %s", err)
+		return internal_error("Error storing country record", err)
+	}
+
+	var holder Country_Holder
+
+	err = t.get_holder(stub, MK_COUNTRY, &holder)
+
+	if err != nil {
+		return err
+	}
+
+	if !contains(holder.Alpha2, c.Alpha2) {
+		holder.Alpha2 = append(holder.Alpha2, c.Alpha2)
+	}
+
+	return t.put_holder(stub, MK_COUNTRY, holder)
+}
+
+//	 retrieve_country - Resolves an alpha-2, alpha-3 or legacy CT_* code to the registered country
+func (t *SimpleChaincode) retrieve_country(stub shim.ChaincodeStubInterface, code string) (Country, error) {
+
+	var c Country
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+
+	if len(code) == 2 {
+		bytes, err := stub.GetState(COUNTRY_KEY_PREFIX + code)
+
+		if err != nil {
+			return c, internal_error("Unable to get country "+code, err)
+		}
+
+		if bytes != nil {
+			err = json.Unmarshal(bytes, &c)
+
+			if err != nil {
+				return c, internal_error("Corrupt country record "+code, err)
+			}
+
+			return c, nil
+		}
+	}
+
+	countries, err := t.retrieve_countries(stub)
+
+	if err != nil {
+		return c, err
+	}
+
+	for _, candidate := range countries {
+		if candidate.Alpha3 == code || candidate.LegacyCode == code {
+			return candidate, nil
+		}
+	}
+
+	return c, not_found("Unknown country " + code)
+}
+
+func (t *SimpleChaincode) retrieve_countries(stub shim.ChaincodeStubInterface) ([]Country, error) {
+
+	var holder Country_Holder
+
+	err := t.get_holder(stub, MK_COUNTRY, &holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	countries := make([]Country, 0, len(holder.Alpha2))
+
+	for _, alpha2 := range holder.Alpha2 {
+		bytes, err := stub.GetState(COUNTRY_KEY_PREFIX + alpha2)
+
+		if err != nil || bytes == nil {
+			return nil, wrap_error(err, "Failed to retrieve country "+alpha2)
+		}
+
+		var c Country
+
+		err = json.Unmarshal(bytes, &c)
+
+		if err != nil {
+			return nil, internal_error("Corrupt country record "+alpha2, err)
+		}
+
+		countries = append(countries, c)
+	}
+
+	return countries, nil
+}
+
+//	 country_code - The alpha-2 code for a registered country, or the code unchanged if it is not registered
+func (t *SimpleChaincode) country_code(stub shim.ChaincodeStubInterface, code string) string {
+
+	c, err := t.retrieve_country(stub, code)
+
+	if err != nil {
+		return code
+	}
+
+	return c.Alpha2
+}
+
+//	 get_countries
+func (t *SimpleChaincode) get_countries(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	countries, err := t.retrieve_countries(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(countries)
+}
+
+//	 get_country
+func (t *SimpleChaincode) get_country(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, code string) ([]byte, error) {
+
+	c, err := t.retrieve_country(stub, code)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(c)
+}
+
+//	 migrate_legacy_countries - Authority only, and run by Init. One-time load of the CT_* countries into the
+//								registry. Existing participants are moved onto alpha-2 codes. Running it again is
+//								a no-op. Runs by an authority are recorded in the oversight log, the Init run is not.
+func (t *SimpleChaincode) migrate_legacy_countries(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	done, err := stub.GetState(MK_COUNTRY_MIGRATION)
+
+	if err != nil {
+		return nil, internal_error("Unable to get MK_COUNTRY_MIGRATION", err)
+	}
+
+	if done != nil {
+		return nil, nil
+	}
+
+	for _, c := range legacyCountries {
+		if _, err := t.retrieve_country(stub, c.Alpha2); err == nil {
+			continue
+		}
+
+		err = t.save_country(stub, c)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var participants Participant_Holder
+
+	err = t.get_holder(stub, MK_PARTICIPANT, &participants)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, participantId := range participants.ParticipantId {
+		bytes, err := t.retrieve_participant(stub, participantId)
+
+		if err != nil || bytes == nil {
+			return nil, wrap_error(err, "migrate_legacy_countries: Failed to retrieve Participant "+participantId)
+		}
+
+		// Decoded generically so fields outside Participant survive the rewrite
+		var record map[string]interface{}
+
+		err = json.Unmarshal(bytes, &record)
+
+		if err != nil {
+			return nil, internal_error("migrate_legacy_countries: Corrupt participant record "+participantId, err)
+		}
+
+		country, _ := record["country"].(string)
+		code := t.country_code(stub, country)
+
+		if code == country {
+			continue
+		}
+
+		record["country"] = code
+
+		bytes, err = json.Marshal(record)
+
+		if err != nil {
+			return nil, internal_error("migrate_legacy_countries: Error converting participant record "+participantId, err)
+		}
+
+		_, err = t.save_participant(stub, bytes, participantId)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = stub.PutState(MK_COUNTRY_MIGRATION, []byte("true"))
+
+	if err != nil {
+		return nil, internal_error("Unable to put the state MK_COUNTRY_MIGRATION", err)
+	}
+
+	if caller == "" {
+		return nil, nil
+	}
+
+	return nil, t.record_oversight(stub, caller, "migrate_legacy_countries", "", "")
+}
+
+//	 validate_country - Participant and port countries must be in the registry
+func (t *SimpleChaincode) validate_country(stub shim.ChaincodeStubInterface, code string) error {
+
+	_, err := t.retrieve_country(stub, code)
+
+	if err != nil {
+		return not_found("Validate: Country " + code + " is not in the country registry")
+	}
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+func is_upper_alpha(s string) bool {
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
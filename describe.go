@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	Description - Returned by describe. Generated from the handler registry and the entity types so that it cannot
+//				  drift from what the chaincode accepts.
+//==============================================================================================================================
+type Description struct {
+	Functions     []FunctionDescription `json:"functions"`
+	Errors        []ErrorDescription    `json:"errors"`
+	ErrorEnvelope *JSONSchema           `json:"errorEnvelope"`
+}
+
+//	FunctionDescription - Errors lists the codes the function can return, from its declaration and dispatch
+type FunctionDescription struct {
+	Name     string           `json:"name"`
+	Access   string           `json:"access"`
+	Roles    []string         `json:"roles"`
+	Usage    string           `json:"usage"`
+	Args     []ArgDescription `json:"args"`
+	Response *JSONSchema      `json:"response,omitempty"`
+	Errors   []string         `json:"errors"`
+}
+
+type ArgDescription struct {
+	Name     string      `json:"name"`
+	Encoding string      `json:"encoding"`
+	Optional bool        `json:"optional"`
+	Schema   *JSONSchema `json:"schema,omitempty"`
+}
+
+type ErrorDescription struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+//	JSONSchema - The subset of JSON Schema needed to describe the entity types
+type JSONSchema struct {
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+	OneOf                []*JSONSchema          `json:"oneOf,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var moneyType = reflect.TypeOf(Money{})
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+//==============================================================================================================================
+//	 Chaincode Methods - Describe
+//==============================================================================================================================
+//	 describe - Every function with its arguments, payload and response schemas, required role and error codes
+func (t *SimpleChaincode) describe(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	d := Description{Functions: []FunctionDescription{}, Errors: []ErrorDescription{}, ErrorEnvelope: schema_of(ErrorEnvelope{})}
+
+	for _, h := range handlerRegistry {
+		d.Functions = append(d.Functions, h.describe())
+	}
+
+	for _, code := range errorCodes {
+		d.Errors = append(d.Errors, ErrorDescription{Code: code, Description: errorCatalogue[code]})
+	}
+
+	return json.Marshal(d)
+}
+
+func (h Handler) describe() FunctionDescription {
+	f := FunctionDescription{Name: h.Name, Access: h.Access, Roles: h.Roles, Usage: h.usage(), Args: []ArgDescription{}}
+
+	if f.Roles == nil {
+		f.Roles = []string{}
+	}
+
+	if h.Response != nil {
+		f.Response = schema_of(h.Response)
+	}
+
+	for _, a := range h.Args {
+		arg := ArgDescription{Name: a.Name, Encoding: a.Encoding, Optional: a.Optional}
+
+		if a.Schema != nil {
+			arg.Schema = schema_of(a.Schema)
+		}
+
+		f.Args = append(f.Args, arg)
+	}
+
+	f.Errors = h.error_codes()
+
+	return f
+}
+
+//	 error_codes - The declared codes plus those raised before the call: dispatch refuses arguments that do not
+//				   match the declaration and callers without the roles it checks, and Invoke refuses unidentified
+//				   callers.
+func (h Handler) error_codes() []string {
+	codes := map[string]bool{EC_INVALID_ARGUMENT: true, EC_INTERNAL: true}
+
+	if h.Access == AC_WRITE || (len(h.Roles) > 0 && h.caller_type_roles()) {
+		codes[EC_PERMISSION_DENIED] = true
+	}
+
+	for _, code := range h.Errors {
+		codes[code] = true
+	}
+
+	result := []string{}
+
+	for _, code := range errorCodes {
+		if codes[code] {
+			result = append(result, code)
+		}
+	}
+
+	return result
+}
+
+//==============================================================================================================================
+//	 Schema Generation
+//==============================================================================================================================
+//	 schema_of - The schema of a sample value's type, or the sample itself when it is already a schema
+func schema_of(sample interface{}) *JSONSchema {
+	if s, ok := sample.(*JSONSchema); ok {
+		return s
+	}
+	return type_schema(reflect.TypeOf(sample), make(map[reflect.Type]bool))
+}
+
+func schema_one_of(samples ...interface{}) *JSONSchema {
+	s := &JSONSchema{}
+
+	for _, sample := range samples {
+		s.OneOf = append(s.OneOf, schema_of(sample))
+	}
+
+	return s
+}
+
+func schema_array(item interface{}) *JSONSchema {
+	return &JSONSchema{Type: "array", Items: schema_of(item)}
+}
+
+//	 type_schema - Follows encoding/json: fields by their json tag, embedded structs without a tag flattened.
+//				   seen stops types that contain themselves.
+func type_schema(t reflect.Type, seen map[reflect.Type]bool) *JSONSchema {
+
+	switch t {
+	case timeType:
+		return &JSONSchema{Type: "string", Format: "date-time"}
+	case moneyType:
+		return type_schema(reflect.TypeOf(moneyJSON{}), seen)
+	case rawMessageType:
+		return &JSONSchema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return type_schema(t.Elem(), seen)
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &JSONSchema{Type: "string", Format: "byte"}
+		}
+		return &JSONSchema{Type: "array", Items: type_schema(t.Elem(), seen)}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: type_schema(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			return &JSONSchema{Type: "object"}
+		}
+
+		seen[t] = true
+		defer delete(seen, t)
+
+		s := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+		add_properties(s, t, seen)
+
+		return s
+	}
+
+	return &JSONSchema{}
+}
+
+func add_properties(s *JSONSchema, t reflect.Type, seen map[reflect.Type]bool) {
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+
+		if tag == "-" {
+			continue
+		}
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				add_properties(s, ft, seen)
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		s.Properties[name] = type_schema(f.Type, seen)
+	}
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//EnrolmentStatus
+const ES_INVITED = "INVITED"
+const ES_ACCEPTED = "ACCEPTED"
+const ES_DECLINED = "DECLINED"
+const ES_EXPIRED = "EXPIRED"
+const ES_REMOVED = "REMOVED"
+const ES_REPLACED = "REPLACED"
+
+//How long an invitation stays open when the inviter does not give an expiry
+const INVITATION_TTL = 7 * 24 * time.Hour
+
+//==============================================================================================================================
+//	 Chaincode Methods - Enrolment Invitations
+//==============================================================================================================================
+//	 invite_participant - Checks and screens a requested enrolment and returns it as a pending invitation. The trade
+//						  is not saved. A blocked screening is returned with a nil error so the record is kept.
+//						  Only accepted participants of the trade and authorities may invite, and the invitee
+//						  always has to accept, even when inviting itself.
+func (t *SimpleChaincode) invite_participant(stub shim.ChaincodeStubInterface, caller string, operation string,
+	v Trade, tParticipant TradeParticipant) (TradeParticipant, ScreeningRecord, error) {
+
+	var screening ScreeningRecord
+
+	if !t.is_authority(stub, caller) && check_acting_participant(v, caller) != nil {
+		return tParticipant, screening, permission_denied(operation + ": Caller " + caller + " may not invite participants to trade " + v.TradeId)
+	}
+
+	err := tParticipant.validate()
+
+	if err != nil {
+		return tParticipant, screening, err
+	}
+
+	err = check_enrolment_open(v, tParticipant)
+
+	if err != nil {
+		return tParticipant, screening, err
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return tParticipant, screening, err
+	}
+
+	tParticipant = new_invitation(tParticipant, caller, now)
+
+	err = t.check_trade_screening(stub, v)
+
+	if err != nil {
+		return tParticipant, screening, err
+	}
+
+	err = t.check_not_blocked(stub, tParticipant.ParticipantID)
+
+	if err != nil {
+		return tParticipant, screening, err
+	}
+
+	err = t.check_participant_active(stub, tParticipant.ParticipantID)
+
+	if err != nil {
+		return tParticipant, screening, err
+	}
+
+	err = t.check_kyc_for_role(stub, tParticipant.ParticipantID, tParticipant.RelationshipType)
+
+	if err != nil {
+		return tParticipant, screening, err
+	}
+
+	subjects, countryPair, err := t.screen_trade_participants(stub, append(current_participants(v), tParticipant))
+
+	if err != nil {
+		return tParticipant, screening, err
+	}
+
+	// Only the new participant is screened by name, the rest were screened when they joined
+	screening, err = t.screen(stub, caller, operation, v.TradeId, subjects[len(subjects)-1:], countryPair)
+
+	if err != nil {
+		return tParticipant, screening, err
+	}
+
+	if screening.Outcome == SO_BLOCKED {
+		logger.Warning(operation + ": Participant " + tParticipant.ParticipantID + " blocked by screening " + screening.ScreeningId)
+	}
+
+	return tParticipant, screening, nil
+}
+
+//	 accept_trade_invitation - The invitee accepts its pending invitation for the relationship
+func (t *SimpleChaincode) accept_trade_invitation(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string,
+	tradeId string, participantId string, relationshipType string) ([]byte, error) {
+
+	return nil, t.respond_to_invitation(stub, caller, tradeId, participantId, relationshipType, ES_ACCEPTED, "")
+}
+
+//	 decline_trade_invitation - The invitee declines its pending invitation for the relationship
+func (t *SimpleChaincode) decline_trade_invitation(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string,
+	tradeId string, participantId string, relationshipType string, reason string) ([]byte, error) {
+
+	return nil, t.respond_to_invitation(stub, caller, tradeId, participantId, relationshipType, ES_DECLINED, reason)
+}
+
+func (t *SimpleChaincode) respond_to_invitation(stub shim.ChaincodeStubInterface, caller string, tradeId string,
+	participantId string, relationshipType string, response string, reason string) error {
+
+	if caller != participantId {
+		return permission_denied("Only " + participantId + " can respond to its invitation")
+	}
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return wrap_error(err, "respond_to_invitation: Failed to retrieve Trade")
+	}
+
+	err = check_not_on_hold(v)
+
+	if err != nil {
+		return err
+	}
+
+	err = t.check_trade_screening(stub, v)
+
+	if err != nil {
+		return err
+	}
+
+	err = t.check_not_blocked(stub, participantId)
+
+	if err != nil {
+		return err
+	}
+
+	i := find_enrolment(v, participantId, relationshipType, ES_INVITED)
+
+	if i < 0 {
+		return invalid_state("No pending invitation for " + participantId + " as " + relationshipType + " on trade " + tradeId)
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return err
+	}
+
+	if v.Participants[i].isExpired(now) {
+		return invalid_state("Invitation for " + participantId + " on trade " + tradeId + " expired on " + v.Participants[i].ExpiryDTTM.String())
+	}
+
+	if response == ES_ACCEPTED {
+		err = t.check_acceptance(stub, participantId, relationshipType)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if response == ES_ACCEPTED {
+		v.Participants[i] = accept_invitation(v.Participants[i], now)
+	} else {
+		v.Participants[i].Status = response
+		v.Participants[i].RespondDTTM = now
+	}
+
+	v.Participants[i].ResponseNote = reason
+
+	_, err = t.save_trade(stub, v)
+
+	if err != nil {
+		fmt.Printf("respond_to_invitation: Error saving changes: %s", err)
+		return internal_error("respond_to_invitation: Error saving changes", err)
+	}
+
+	return t.index_participant_trade(stub, tradeId, v.Participants[i])
+}
+
+//	 expire_trade_invitations - Marks every pending invitation on the trade that is past its expiry as expired. Only
+//								accepted participants of the trade and authorities may run it.
+func (t *SimpleChaincode) expire_trade_invitations(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, tradeId string) ([]byte, error) {
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "expire_trade_invitations: Failed to retrieve Trade")
+	}
+
+	if !t.is_authority(stub, caller) && check_acting_participant(v, caller) != nil {
+		return nil, permission_denied("expire_trade_invitations: Caller " + caller + " may not expire invitations on trade " + tradeId)
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []TradeParticipant
+
+	for i := range v.Participants {
+		if v.Participants[i].Status == ES_INVITED && v.Participants[i].isExpired(now) {
+			v.Participants[i].Status = ES_EXPIRED
+			expired = append(expired, v.Participants[i])
+		}
+	}
+
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	_, err = t.save_trade(stub, v)
+
+	if err != nil {
+		fmt.Printf("expire_trade_invitations: Error saving changes: %s", err)
+		return nil, internal_error("expire_trade_invitations: Error saving changes", err)
+	}
+
+	for _, tp := range expired {
+		err = t.index_participant_trade(stub, tradeId, tp)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+//	 remove_participant_from_trade - Ends an enrolment or withdraws an invitation. The enrolment is kept with its
+//									 effective-to date. A participant that has acted on the trade cannot be removed.
+func (t *SimpleChaincode) remove_participant_from_trade(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string,
+	tradeId string, participantId string, relationshipType string, reason string) ([]byte, error) {
+
+	v, i, err := t.retrieve_enrolment_for_change(stub, caller, tradeId, participantId, relationshipType, reason)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	end_enrolment(&v.Participants[i], ES_REMOVED, caller, reason, "", now)
+
+	_, err = t.save_trade(stub, v)
+
+	if err != nil {
+		fmt.Printf("remove_participant_from_trade: Error saving changes: %s", err)
+		return nil, internal_error("remove_participant_from_trade: Error saving changes", err)
+	}
+
+	return nil, t.index_participant_trade(stub, tradeId, v.Participants[i])
+}
+
+//	 replace_participant_on_trade - Ends the enrolment and invites the replacement for the same relationship
+func (t *SimpleChaincode) replace_participant_on_trade(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string,
+	tradeId string, participantId string, relationshipType string, replacementId string, reason string) ([]byte, error) {
+
+	v, i, err := t.retrieve_enrolment_for_change(stub, caller, tradeId, participantId, relationshipType, reason)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if replacementId == "" || replacementId == participantId {
+		return nil, validation_error("replace_participant_on_trade: A different replacement participant is required")
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	end_enrolment(&v.Participants[i], ES_REPLACED, caller, reason, replacementId, now)
+
+	replacement, screening, err := t.invite_participant(stub, caller, "replace_participant_on_trade", v,
+		TradeParticipant{ParticipantID: replacementId, RelationshipType: relationshipType})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if screening.Outcome == SO_BLOCKED {
+		return json.Marshal(screening)
+	}
+
+	v.Participants = append(v.Participants, replacement)
+
+	_, err = t.save_trade(stub, v)
+
+	if err != nil {
+		fmt.Printf("replace_participant_on_trade: Error saving changes: %s", err)
+		return nil, internal_error("replace_participant_on_trade: Error saving changes", err)
+	}
+
+	err = t.index_participant_trade(stub, tradeId, v.Participants[i])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, t.index_participant_trade(stub, tradeId, replacement)
+}
+
+//	 retrieve_enrolment_for_change - Loads the trade and finds the current enrolment that is to be removed or replaced.
+//									 Authorities and accepted participants of the trade may make the change.
+func (t *SimpleChaincode) retrieve_enrolment_for_change(stub shim.ChaincodeStubInterface, caller string, tradeId string,
+	participantId string, relationshipType string, reason string) (Trade, int, error) {
+
+	if reason == "" {
+		return Trade{}, -1, validation_error("A reason is required to change trade participants")
+	}
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return v, -1, wrap_error(err, "Failed to retrieve Trade "+tradeId)
+	}
+
+	err = check_not_on_hold(v)
+
+	if err != nil {
+		return v, -1, err
+	}
+
+	if !t.is_authority(stub, caller) && check_acting_participant(v, caller) != nil {
+		return v, -1, permission_denied("Caller " + caller + " may not change the participants of trade " + tradeId)
+	}
+
+	i := -1
+
+	for j, tp := range v.Participants {
+		if tp.ParticipantID == participantId && tp.RelationshipType == relationshipType && tp.isCurrent() {
+			i = j
+		}
+	}
+
+	if i < 0 {
+		return v, -1, invalid_state("Participant " + participantId + " is not enrolled as " + relationshipType + " on trade " + tradeId)
+	}
+
+	if v.Participants[i].isActive() && has_acted(v, participantId) {
+		return v, -1, invalid_state("Participant " + participantId + " has already acted on trade " + tradeId + " and cannot be removed")
+	}
+
+	return v, i, nil
+}
+
+//	 check_enrolment_open - A participant can hold a relationship once; a new invitation is only allowed after the
+//							previous one was declined or expired.
+func check_enrolment_open(v Trade, tp TradeParticipant) error {
+	if find_enrolment(v, tp.ParticipantID, tp.RelationshipType, ES_INVITED) >= 0 ||
+		find_enrolment(v, tp.ParticipantID, tp.RelationshipType, ES_ACCEPTED) >= 0 ||
+		find_enrolment(v, tp.ParticipantID, tp.RelationshipType, "") >= 0 {
+		return conflict("Participant " + tp.ParticipantID + " is already invited or enrolled as " + tp.RelationshipType)
+	}
+	return nil
+}
+
+//	 check_acting_participant - Only participants that accepted their enrolment can act on the trade
+func check_acting_participant(v Trade, participantId string) error {
+	for _, tp := range v.Participants {
+		if tp.ParticipantID == participantId && tp.isActive() {
+			return nil
+		}
+	}
+	return invalid_state("Participant " + participantId + " is not an accepted participant of trade " + v.TradeId)
+}
+
+//	 check_acceptance - Accepting an enrolment, including the trade creator's own, needs an active participant with
+//						the KYC its relationship requires
+func (t *SimpleChaincode) check_acceptance(stub shim.ChaincodeStubInterface, participantId string, relationshipType string) error {
+
+	err := t.check_participant_active(stub, participantId)
+
+	if err != nil {
+		return err
+	}
+
+	return t.check_kyc_for_role(stub, participantId, relationshipType)
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+//	 new_invitation - Turns a requested enrolment into a pending invitation
+func new_invitation(tp TradeParticipant, caller string, now time.Time) TradeParticipant {
+	tp.InvitedBy = caller
+	tp.InviteDTTM = now
+	tp.EnrolDTTM = now
+	tp.RespondDTTM = time.Time{}
+	tp.ResponseNote = ""
+
+	if tp.ExpiryDTTM.IsZero() || !tp.ExpiryDTTM.After(now) {
+		tp.ExpiryDTTM = now.Add(INVITATION_TTL)
+	}
+
+	tp.EffectiveFromDTTM = time.Time{}
+	tp.EffectiveToDTTM = time.Time{}
+	tp.EndedBy = ""
+	tp.EndReason = ""
+	tp.ReplacedBy = ""
+	tp.Status = ES_INVITED
+
+	return tp
+}
+
+//	 accept_invitation - Callers run check_acceptance first
+func accept_invitation(tp TradeParticipant, now time.Time) TradeParticipant {
+	tp.Status = ES_ACCEPTED
+	tp.RespondDTTM = now
+	tp.EffectiveFromDTTM = now
+
+	return tp
+}
+
+func find_enrolment(v Trade, participantId string, relationshipType string, status string) int {
+	for i, tp := range v.Participants {
+		if tp.ParticipantID == participantId && tp.RelationshipType == relationshipType && tp.Status == status {
+			return i
+		}
+	}
+	return -1
+}
+
+//	 end_enrolment - Closes an enrolment without deleting it
+func end_enrolment(tp *TradeParticipant, status string, caller string, reason string, replacedBy string, now time.Time) {
+	tp.Status = status
+	tp.EffectiveToDTTM = now
+	tp.EndedBy = caller
+	tp.EndReason = reason
+	tp.ReplacedBy = replacedBy
+}
+
+//	 has_acted - True once the participant has attached documents to the trade
+func has_acted(v Trade, participantId string) bool {
+	for _, d := range v.Docs {
+		if d.AddedBy == participantId {
+			return true
+		}
+	}
+	return false
+}
+
+//	 isActive - Accepted enrolments, and enrolments made before invitations existed, count towards the trade
+func (tp TradeParticipant) isActive() bool {
+	return tp.Status == ES_ACCEPTED || tp.Status == ""
+}
+
+//	 isCurrent - Active enrolments and invitations still awaiting an answer
+func (tp TradeParticipant) isCurrent() bool {
+	return tp.isActive() || tp.Status == ES_INVITED
+}
+
+func (tp TradeParticipant) isExpired(now time.Time) bool {
+	return tp.Status == ES_INVITED && !tp.ExpiryDTTM.IsZero() && now.After(tp.ExpiryDTTM)
+}
+
+//	 current_participants - Enrolments that have not been declined, expired, removed or replaced
+func current_participants(v Trade) []TradeParticipant {
+	var result []TradeParticipant
+	for _, tp := range v.Participants {
+		if tp.isCurrent() {
+			result = append(result, tp)
+		}
+	}
+	return result
+}
+
+//	 active_participants - The enrolments that count towards roles on the trade
+func active_participants(v Trade) []TradeParticipant {
+	var result []TradeParticipant
+	for _, tp := range v.Participants {
+		if tp.isActive() {
+			result = append(result, tp)
+		}
+	}
+	return result
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//ErrorCode - Stable codes returned in the error envelope. Clients branch on the code, never on the message.
+const EC_VALIDATION = "VALIDATION_FAILED"
+const EC_INVALID_ARGUMENT = "INVALID_ARGUMENT"
+const EC_NOT_FOUND = "NOT_FOUND"
+const EC_CONFLICT = "CONFLICT"
+const EC_PERMISSION_DENIED = "PERMISSION_DENIED"
+const EC_INVALID_STATE = "INVALID_STATE"
+const EC_UNKNOWN_FUNCTION = "UNKNOWN_FUNCTION"
+const EC_INTERNAL = "INTERNAL"
+
+var errorCodes = []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_CONFLICT, EC_PERMISSION_DENIED,
+	EC_INVALID_STATE, EC_UNKNOWN_FUNCTION, EC_INTERNAL}
+
+var errorCatalogue = map[string]string{
+	EC_VALIDATION:        "The payload is well formed but breaks one or more rules, see fields",
+	EC_INVALID_ARGUMENT:  "An argument is missing, not base64, not valid JSON or not in the expected format",
+	EC_NOT_FOUND:         "The trade, document, participant or reference record does not exist",
+	EC_CONFLICT:          "The record already exists or clashes with one that does",
+	EC_PERMISSION_DENIED: "The caller may not perform the operation",
+	EC_INVALID_STATE:     "The entity is not in a state that allows the operation, e.g. on hold or already declared",
+	EC_UNKNOWN_FUNCTION:  "No function by that name",
+	EC_INTERNAL:          "The ledger could not be read or written, or holds a record that cannot be parsed",
+}
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	ChaincodeError - An error with a catalogue code. Cause keeps the error it was raised from, Fields the rules a
+//					 payload failed.
+//==============================================================================================================================
+type ChaincodeError struct {
+	Code    string
+	Message string
+	Fields  []FieldError
+	Cause   error
+}
+
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+//	ErrorEnvelope - What Invoke and Query return as the error message, e.g.
+//					{"error":{"code":"NOT_FOUND","message":"Trade 100001 does not exist"}}
+type ErrorEnvelope struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Fields  []FieldError `json:"fields,omitempty"`
+	Cause   string       `json:"cause,omitempty"`
+}
+
+func (e *ChaincodeError) Error() string {
+	if e.Cause == nil {
+		return e.Message
+	}
+	return e.Message + ": " + e.Cause.Error()
+}
+
+//==============================================================================================================================
+//	 Constructors
+//==============================================================================================================================
+func new_error(code string, message string, cause error) *ChaincodeError {
+	return &ChaincodeError{Code: code, Message: message, Cause: cause}
+}
+
+func validation_error(message string, fields ...FieldError) *ChaincodeError {
+	return &ChaincodeError{Code: EC_VALIDATION, Message: message, Fields: fields}
+}
+
+func invalid_argument(message string, cause error) *ChaincodeError {
+	return new_error(EC_INVALID_ARGUMENT, message, cause)
+}
+
+func not_found(message string) *ChaincodeError {
+	return new_error(EC_NOT_FOUND, message, nil)
+}
+
+func conflict(message string) *ChaincodeError {
+	return new_error(EC_CONFLICT, message, nil)
+}
+
+func permission_denied(message string) *ChaincodeError {
+	return new_error(EC_PERMISSION_DENIED, message, nil)
+}
+
+func invalid_state(message string) *ChaincodeError {
+	return new_error(EC_INVALID_STATE, message, nil)
+}
+
+func internal_error(message string, cause error) *ChaincodeError {
+	return new_error(EC_INTERNAL, message, cause)
+}
+
+//	 wrap_error - Adds context to err while keeping its code and field details, so a not-found raised deep in a
+//				  retrieve is still a not-found when it reaches the client
+func wrap_error(err error, context string) *ChaincodeError {
+	return &ChaincodeError{Code: error_code(err), Message: context, Fields: error_fields(err), Cause: err}
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+//	 error_code - The catalogue code of err. Errors raised outside the catalogue are internal.
+func error_code(err error) string {
+	if ce, ok := err.(*ChaincodeError); ok {
+		return ce.Code
+	}
+	return EC_INTERNAL
+}
+
+func error_fields(err error) []FieldError {
+	if ce, ok := err.(*ChaincodeError); ok {
+		return ce.Fields
+	}
+	return nil
+}
+
+//	 error_envelope - Converts err into the JSON envelope returned to the client. The full cause chain is logged.
+func error_envelope(function string, err error) error {
+	body := ErrorBody{Code: error_code(err), Message: err.Error(), Fields: error_fields(err)}
+
+	if ce, ok := err.(*ChaincodeError); ok {
+		body.Message = ce.Message
+
+		if ce.Cause != nil {
+			body.Cause = ce.Cause.Error()
+		}
+	}
+
+	logger.Error(function + ": " + body.Code + ": " + err.Error())
+
+	bytes, jsonErr := json.Marshal(ErrorEnvelope{Error: body})
+
+	if jsonErr != nil {
+		return err
+	}
+
+	return errors.New(string(bytes))
+}
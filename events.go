@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//Version of the event payload below. Adding fields keeps the version; renaming, removing or changing the meaning
+//of a field increments it.
+const EVENT_SCHEMA_VERSION = "1.0"
+
+//EntityType
+const ET_TRADE = "TRADE"
+const ET_DOCUMENT = "DOCUMENT"
+const ET_PARTICIPANT = "PARTICIPANT"
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	ChaincodeEvent - Payload of the chaincode event set by each state-changing operation. The event name is the
+//					 operation, e.g. "add_trade_state", so listeners can register for the operations they need.
+//
+//		version			EVENT_SCHEMA_VERSION of the payload
+//		entityType		TRADE, DOCUMENT or PARTICIPANT
+//		entityId		Trade, document or participant ID
+//		action			Operation that changed the entity
+//		previousState	State before the operation, empty for a new entity. The trade state, except for
+//						add_participant_to_trade where it is the enrolment status and create_participant
+//						and create_document where it is the participant status and document type
+//		newState		State after the operation
+//		actor			Participant ID of the caller
+//		txId			Transaction that set the event
+//		eventDTTM		When the operation ran
+//		detail			Operation-specific values, e.g. docId for add_doc_to_trade
+//
+//	Fabric keeps one event per transaction, so an operation sets a single event describing its main change.
+//==============================================================================================================================
+type ChaincodeEvent struct {
+	Version       string            `json:"version"`
+	EntityType    string            `json:"entityType"`
+	EntityId      string            `json:"entityId"`
+	Action        string            `json:"action"`
+	PreviousState string            `json:"previousState"`
+	NewState      string            `json:"newState"`
+	Actor         string            `json:"actor"`
+	TxId          string            `json:"txId"`
+	EventDTTM     time.Time         `json:"eventDTTM"`
+	Detail        map[string]string `json:"detail,omitempty"`
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Events
+//==============================================================================================================================
+//	 emit_event - Sets the chaincode event for the transaction
+func (t *SimpleChaincode) emit_event(stub shim.ChaincodeStubInterface, caller string, action string, entityType string,
+	entityId string, previousState string, newState string, detail map[string]string) error {
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return err
+	}
+
+	event := ChaincodeEvent{
+		Version:       EVENT_SCHEMA_VERSION,
+		EntityType:    entityType,
+		EntityId:      entityId,
+		Action:        action,
+		PreviousState: previousState,
+		NewState:      newState,
+		Actor:         caller,
+		TxId:          stub.GetTxID(),
+		EventDTTM:     now,
+		Detail:        detail,
+	}
+
+	bytes, err := json.Marshal(event)
+
+	if err != nil {
+		return internal_error("Error converting event for "+action, err)
+	}
+
+	err = stub.SetEvent(action, bytes)
+
+	if err != nil {
+		logger.Error("EMIT_EVENT: Unable to set event " + action + ": " + err.Error())
+		return internal_error("Unable to set event for "+action, err)
+	}
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+//	 current_state - The latest state of the trade, empty if it has none
+func current_state(v Trade) string {
+	if len(v.States) == 0 {
+		return ""
+	}
+	return v.States[len(v.States)-1].State
+}
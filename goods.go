@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	GoodsLine - One line of the goods shipped under a trade. Weights are in kilograms.
+//==============================================================================================================================
+type GoodsLine struct {
+	LineNum           int     `json:"lineNum"`
+	HSCode            string  `json:"hsCode"`
+	Description       string  `json:"description"`
+	Quantity          int64   `json:"quantity"`
+	Unit              string  `json:"unit"`
+	NetWeightKg       float64 `json:"netWeightKg"`
+	GrossWeightKg     float64 `json:"grossWeightKg"`
+	UnitPrice         Money   `json:"unitPrice"`
+	CountryOfOrigin   string  `json:"countryOfOrigin"`
+	Marks             string  `json:"marks"`
+	PreferenceClaimed bool    `json:"preferenceClaimed"`
+}
+
+type GoodsTotals struct {
+	Lines         int              `json:"lines"`
+	Quantities    map[string]int64 `json:"quantities"`
+	NetWeightKg   float64          `json:"netWeightKg"`
+	GrossWeightKg float64          `json:"grossWeightKg"`
+	Values        map[string]Money `json:"values"`
+	BaseValue     *Money           `json:"baseValue,omitempty"`
+}
+
+//	GoodsSummary - Returned by get_goods_summary
+type GoodsSummary struct {
+	TradeId string      `json:"tradeId"`
+	Goods   []GoodsLine `json:"goods"`
+	Totals  GoodsTotals `json:"totals"`
+}
+
+//==============================================================================================================================
+//	 Validation
+//==============================================================================================================================
+func (g GoodsLine) validate() error {
+	v := new_validator()
+
+	v.positive("lineNum", int64(g.LineNum))
+	v.required("hsCode", g.HSCode)
+	v.format("hsCode", g.HSCode, is_valid_hs_code(g.HSCode), "6 to 10 digits")
+	v.text("description", g.Description, MAX_TEXT_LENGTH)
+	v.positive("quantity", g.Quantity)
+	v.required("unit", g.Unit)
+	v.check("netWeightKg", g.NetWeightKg > 0, VR_POSITIVE)
+	v.check("grossWeightKg", g.GrossWeightKg >= g.NetWeightKg, "must not be less than netWeightKg")
+	v.check("unitPrice", g.UnitPrice.isPositive(), "must be a positive amount in a supported currency")
+	v.required("countryOfOrigin", g.CountryOfOrigin)
+
+	return v.result("GoodsLine")
+}
+
+//	 validate_goods_lines - Adds the failures of every line, and of repeated line numbers, to v
+func validate_goods_lines(v *Validator, goods []GoodsLine) {
+	seen := make(map[int]bool)
+
+	for i, g := range goods {
+		v.nested(index_field("goods", i), g.validate())
+
+		if g.LineNum > 0 && seen[g.LineNum] {
+			v.fail(index_field("goods", i)+".lineNum", "must be unique, "+strconv.Itoa(g.LineNum)+" is repeated")
+		}
+		seen[g.LineNum] = true
+	}
+}
+
+//	 validate_goods - Validates every line, unique line numbers and origin countries against the registry
+func (t *SimpleChaincode) validate_goods(stub shim.ChaincodeStubInterface, goods []GoodsLine) error {
+
+	v := new_validator()
+
+	validate_goods_lines(v, goods)
+
+	err := v.result("Goods")
+
+	if err != nil {
+		return err
+	}
+
+	return t.check_goods_countries(stub, goods)
+}
+
+//	 check_goods_countries - Every origin country must be in the country registry
+func (t *SimpleChaincode) check_goods_countries(stub shim.ChaincodeStubInterface, goods []GoodsLine) error {
+
+	for _, g := range goods {
+		err := t.validate_country(stub, g.CountryOfOrigin)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Goods
+//==============================================================================================================================
+//	 set_trade_goods - Replaces the goods on a trade. Goods are frozen once the trade has been declared, and attached
+//					   invoices must still agree with the new lines.
+func (t *SimpleChaincode) set_trade_goods(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, json_data []byte, tradeId string) ([]byte, error) {
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "set_trade_goods: Failed to retrieve Trade")
+	}
+
+	err = check_not_on_hold(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.check_trade_screening(stub, v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !t.is_authority(stub, caller) && check_acting_participant(v, caller) != nil {
+		return nil, permission_denied("Caller " + caller + " may not change the goods of trade " + tradeId)
+	}
+
+	if has_state(v, WS_TRADE_DECLARED) {
+		return nil, invalid_state("set_trade_goods: Trade " + tradeId + " has been declared, goods can no longer change")
+	}
+
+	var goods []GoodsLine
+
+	err = json.Unmarshal(json_data, &goods)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for set_trade_goods", err)
+	}
+
+	err = t.validate_goods(stub, goods)
+
+	if err != nil {
+		return nil, err
+	}
+
+	v.Goods = goods
+
+	err = t.cross_check_trade_invoices(stub, v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = check_container_allocations(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = t.save_trade(stub, v)
+
+	if err != nil {
+		fmt.Printf("set_trade_goods: Error saving changes: %s", err)
+		return nil, internal_error("set_trade_goods: Error saving changes", err)
+	}
+
+	return nil, nil
+}
+
+//	 get_goods_summary - The goods lines of a trade with their totals. The total is also given in the base currency
+//						 when exchange rates are published for every currency on the trade.
+func (t *SimpleChaincode) get_goods_summary(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, tradeId string) ([]byte, error) {
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "Failed to retrieve Trade")
+	}
+
+	if !t.can_read_trade(stub, v, caller) {
+		return nil, permission_denied("Caller " + caller + " is not permitted to read trade " + tradeId)
+	}
+
+	totals, err := goods_totals(v.Goods)
+
+	if err != nil {
+		return nil, wrap_error(err, "Failed to total goods for trade "+tradeId)
+	}
+
+	base := zero_money(BASE_CURRENCY)
+	now := time.Now()
+
+	for _, value := range totals.Values {
+		converted, err := t.to_base_currency(stub, value, now)
+
+		if err != nil {
+			base.Currency = ""
+			break
+		}
+
+		base, err = base.add(converted)
+
+		if err != nil {
+			base.Currency = ""
+			break
+		}
+	}
+
+	if base.Currency != "" {
+		totals.BaseValue = &base
+	}
+
+	summary := GoodsSummary{tradeId, v.Goods, totals}
+
+	return json.Marshal(summary)
+}
+
+//	 cross_check_trade_invoices - Every summary invoice attached to the trade must agree with its goods
+func (t *SimpleChaincode) cross_check_trade_invoices(stub shim.ChaincodeStubInterface, v Trade) error {
+
+	for _, d := range v.Docs {
+		invoice, found, err := t.retrieve_summary_invoice(stub, d.DocId)
+
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			continue
+		}
+
+		err = cross_check_invoice(v.Goods, invoice)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//	 retrieve_summary_invoice - found is false when the document exists but is not a summary invoice
+func (t *SimpleChaincode) retrieve_summary_invoice(stub shim.ChaincodeStubInterface, docId string) (SummaryInvoice, bool, error) {
+
+	var invoice SummaryInvoice
+
+	bytes, err := t.retrieve_document(stub, docId)
+
+	if err != nil || bytes == nil {
+		return invoice, false, wrap_error(err, "Failed to retrieve Document "+docId)
+	}
+
+	err = json.Unmarshal(bytes, &invoice)
+
+	if err != nil {
+		return invoice, false, internal_error("Corrupt document record "+docId, err)
+	}
+
+	return invoice, invoice.Type == DT_SMRY_INVOICE, nil
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+//	 cross_check_invoice - Invoice lines must match the goods line with the same line number on HS code, quantity,
+//						   unit and value. Trades without goods lines are not checked.
+func cross_check_invoice(goods []GoodsLine, invoice SummaryInvoice) error {
+	if len(goods) == 0 {
+		return nil
+	}
+
+	byLine := make(map[int]GoodsLine)
+
+	for _, g := range goods {
+		byLine[g.LineNum] = g
+	}
+
+	for _, line := range invoice.Lines {
+		prefix := "Invoice " + invoice.DocId + " line " + strconv.Itoa(line.LineNum) + ": "
+
+		g, found := byLine[line.LineNum]
+
+		if !found {
+			return validation_error(prefix + "No matching goods line")
+		}
+
+		if normalise_hs_code(line.HSCode) != normalise_hs_code(g.HSCode) {
+			return validation_error(prefix + "HS code " + line.HSCode + " does not match goods HS code " + g.HSCode)
+		}
+
+		if line.Quantity != g.Quantity || !strings.EqualFold(line.Unit, g.Unit) {
+			return validation_error(prefix + "Quantity does not match goods line")
+		}
+
+		amount, err := g.UnitPrice.times(g.Quantity)
+
+		if err != nil {
+			return validation_error(prefix + err.Error())
+		}
+
+		if line.Amount != amount {
+			return validation_error(prefix + "Amount does not equal goods quantity times unit price")
+		}
+	}
+
+	return nil
+}
+
+func goods_totals(goods []GoodsLine) (GoodsTotals, error) {
+	totals := GoodsTotals{Quantities: make(map[string]int64), Values: make(map[string]Money)}
+
+	for _, g := range goods {
+		totals.Lines++
+		totals.Quantities[strings.ToUpper(g.Unit)] += g.Quantity
+		totals.NetWeightKg += g.NetWeightKg
+		totals.GrossWeightKg += g.GrossWeightKg
+
+		amount, err := g.UnitPrice.times(g.Quantity)
+
+		if err != nil {
+			return totals, err
+		}
+
+		value, found := totals.Values[g.UnitPrice.Currency]
+
+		if !found {
+			value = zero_money(g.UnitPrice.Currency)
+		}
+
+		value, err = value.add(amount)
+
+		if err != nil {
+			return totals, err
+		}
+
+		totals.Values[g.UnitPrice.Currency] = value
+	}
+
+	return totals, nil
+}
+
+func is_valid_hs_code(hsCode string) bool {
+	code := normalise_hs_code(hsCode)
+
+	if len(code) < 6 || len(code) > 10 {
+		return false
+	}
+
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func has_state(v Trade, state string) bool {
+	for _, s := range v.States {
+		if s.State == state {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"runtime"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//Versions
+const CHAINCODE_VERSION = "2.0.0"
+const LEDGER_SCHEMA_VERSION = "2" // Layout of the records on the ledger; raised when existing records need migrating
+
+//Health status
+const HS_OK = "OK"
+const HS_DEGRADED = "DEGRADED" // The consistency check found problems
+
+//Build info, set at build time with -ldflags "-X main.buildCommit=<commit> -X main.buildDate=<date>"
+var buildCommit = "unknown"
+var buildDate = "unknown"
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	HealthReport - Returned by health. Counts are taken from the holders; Problems lists each holder that is missing
+//				   or does not parse.
+//==============================================================================================================================
+type HealthReport struct {
+	Status             string         `json:"status"`
+	Version            string         `json:"version"`
+	SchemaVersion      string         `json:"schemaVersion"`
+	EventSchemaVersion string         `json:"eventSchemaVersion"`
+	Build              BuildInfo      `json:"build"`
+	Counts             map[string]int `json:"counts"`
+	Problems           []string       `json:"problems"`
+}
+
+type BuildInfo struct {
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+}
+
+//	HolderCheck - A holder record read by health. Required holders are written by Init; the others are written with
+//				  their first entry, and until then count as Empty.
+type HolderCheck struct {
+	Entity   string
+	Key      string
+	Required bool
+	Empty    int
+	Count    func(bytes []byte) (int, error)
+}
+
+var holderChecks = []HolderCheck{
+	{Entity: "trades", Key: MK_TRADE, Required: true, Count: func(bytes []byte) (int, error) {
+		var h Trade_Holder
+		err := json.Unmarshal(bytes, &h)
+		return len(h.TradeId), err
+	}},
+	{Entity: "documents", Key: MK_DOCUMENT, Required: true, Count: func(bytes []byte) (int, error) {
+		var h Document_Holder
+		err := json.Unmarshal(bytes, &h)
+		return len(h.DocumentId), err
+	}},
+	{Entity: "participants", Key: MK_PARTICIPANT, Required: true, Count: func(bytes []byte) (int, error) {
+		var h Participant_Holder
+		err := json.Unmarshal(bytes, &h)
+		return len(h.ParticipantId), err
+	}},
+	{Entity: "countries", Key: MK_COUNTRY, Required: true, Count: func(bytes []byte) (int, error) {
+		var h Country_Holder
+		err := json.Unmarshal(bytes, &h)
+		return len(h.Alpha2), err
+	}},
+	{Entity: "documentRules", Key: MK_DOC_RULE, Empty: len(defaultDocumentRules), Count: func(bytes []byte) (int, error) {
+		var h DocumentRule_Holder
+		err := json.Unmarshal(bytes, &h)
+		return len(h.Rules), err
+	}},
+	{Entity: "templates", Key: MK_TEMPLATE, Count: func(bytes []byte) (int, error) {
+		var h Template_Holder
+		err := json.Unmarshal(bytes, &h)
+		return len(h.TemplateIds), err
+	}},
+	{Entity: "exchangeRatePairs", Key: MK_EXCHANGE_RATE, Count: func(bytes []byte) (int, error) {
+		var h ExchangeRate_Holder
+		err := json.Unmarshal(bytes, &h)
+		return len(h.Pairs), err
+	}},
+	{Entity: "deniedParties", Key: MK_DENIED_PARTY, Count: func(bytes []byte) (int, error) {
+		var h DeniedParty_Holder
+		err := json.Unmarshal(bytes, &h)
+		return len(h.EntryId), err
+	}},
+	{Entity: "embargoRules", Key: MK_EMBARGO, Count: func(bytes []byte) (int, error) {
+		var h Embargo_Holder
+		err := json.Unmarshal(bytes, &h)
+		return len(h.Rules), err
+	}},
+	{Entity: "screenings", Key: MK_SCREENING, Count: func(bytes []byte) (int, error) {
+		var h Screening_Holder
+		err := json.Unmarshal(bytes, &h)
+		return len(h.ScreeningId), err
+	}},
+	{Entity: "oversightEntries", Key: MK_OVERSIGHT, Count: func(bytes []byte) (int, error) {
+		var h Oversight_Holder
+		err := json.Unmarshal(bytes, &h)
+		return len(h.EntryId), err
+	}},
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Health
+//==============================================================================================================================
+//	 health - Versions, build info and entity counts. A holder that is missing or does not parse is reported as a
+//			  problem rather than failing the query, so the report is available when it is most needed.
+func (t *SimpleChaincode) health(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	report := HealthReport{
+		Status:             HS_OK,
+		Version:            CHAINCODE_VERSION,
+		SchemaVersion:      LEDGER_SCHEMA_VERSION,
+		EventSchemaVersion: EVENT_SCHEMA_VERSION,
+		Build:              BuildInfo{Commit: buildCommit, Date: buildDate, GoVersion: runtime.Version()},
+		Counts:             make(map[string]int),
+		Problems:           []string{},
+	}
+
+	for _, check := range holderChecks {
+		bytes, err := stub.GetState(check.Key)
+
+		if err != nil {
+			report.Problems = append(report.Problems, "Unable to get "+check.Key+": "+err.Error())
+			continue
+		}
+
+		if bytes == nil {
+			if check.Required {
+				report.Problems = append(report.Problems, "Holder "+check.Key+" is missing")
+			}
+			report.Counts[check.Entity] = check.Empty
+			continue
+		}
+
+		count, err := check.Count(bytes)
+
+		if err != nil {
+			report.Problems = append(report.Problems, "Holder "+check.Key+" does not parse: "+err.Error())
+			continue
+		}
+
+		report.Counts[check.Entity] = count
+	}
+
+	// Audit entries have no holder, they are counted by range
+	count, err := t.count_audit_entries(stub)
+
+	if err != nil {
+		report.Problems = append(report.Problems, "Unable to count audit entries: "+err.Error())
+	} else {
+		report.Counts["auditEntries"] = count
+	}
+
+	if len(report.Problems) > 0 {
+		report.Status = HS_DEGRADED
+	}
+
+	return json.Marshal(report)
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//Incoterms 2020
+const IT_EXW = "EXW"
+const IT_FCA = "FCA"
+const IT_FAS = "FAS"
+const IT_FOB = "FOB"
+const IT_CFR = "CFR"
+const IT_CIF = "CIF"
+const IT_CPT = "CPT"
+const IT_CIP = "CIP"
+const IT_DAP = "DAP"
+const IT_DPU = "DPU"
+const IT_DDP = "DDP"
+
+//The seller is the exporter and the buyer the importer on the trade
+const SELLER = TR_EXPORTER
+const BUYER = TR_IMPORTER
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	Incoterm - The Incoterms 2020 rule agreed for the trade and the place it names
+//==============================================================================================================================
+type Incoterm struct {
+	Code       string `json:"code"`
+	NamedPlace string `json:"namedPlace"`
+}
+
+//	Responsibilities - Which trade relationship is responsible for each stage. Insurance is empty when neither
+//					   party is obliged to insure.
+type Responsibilities struct {
+	ExportClearance string `json:"exportClearance"`
+	MainCarriage    string `json:"mainCarriage"`
+	Insurance       string `json:"insurance"`
+	ImportClearance string `json:"importClearance"`
+	RiskTransfer    string `json:"riskTransfer"`
+	SeaOnly         bool   `json:"seaOnly"`
+}
+
+type DocumentResponsibility struct {
+	DocType          string `json:"docType"`
+	RelationshipType string `json:"relationshipType"`
+}
+
+//	TradeResponsibilities - Returned by get_trade_responsibilities. DocId is empty until the document is attached.
+type TradeResponsibilities struct {
+	TradeId          string           `json:"tradeId"`
+	Incoterm         Incoterm         `json:"incoterm"`
+	Responsibilities Responsibilities `json:"responsibilities"`
+	Documents        []DocumentStatus `json:"documents"`
+}
+
+type DocumentStatus struct {
+	DocumentResponsibility
+	DocId string `json:"docId"`
+}
+
+//==============================================================================================================================
+//	 Incoterm Rules
+//==============================================================================================================================
+var incoterms = map[string]Responsibilities{
+	IT_EXW: {BUYER, BUYER, "", BUYER, "Goods placed at the buyer's disposal at the named place, not loaded", false},
+	IT_FCA: {SELLER, BUYER, "", BUYER, "Goods delivered to the buyer's carrier at the named place", false},
+	IT_FAS: {SELLER, BUYER, "", BUYER, "Goods placed alongside the vessel at the named port of shipment", true},
+	IT_FOB: {SELLER, BUYER, "", BUYER, "Goods on board the vessel at the named port of shipment", true},
+	IT_CFR: {SELLER, SELLER, "", BUYER, "Goods on board the vessel at the port of shipment", true},
+	IT_CIF: {SELLER, SELLER, SELLER, BUYER, "Goods on board the vessel at the port of shipment", true},
+	IT_CPT: {SELLER, SELLER, "", BUYER, "Goods handed to the first carrier", false},
+	IT_CIP: {SELLER, SELLER, SELLER, BUYER, "Goods handed to the first carrier", false},
+	IT_DAP: {SELLER, SELLER, "", BUYER, "Goods ready for unloading at the named place of destination", false},
+	IT_DPU: {SELLER, SELLER, "", BUYER, "Goods unloaded at the named place of destination", false},
+	IT_DDP: {SELLER, SELLER, "", SELLER, "Goods ready for unloading at the named place of destination, import cleared", false},
+}
+
+func (i Incoterm) validate() error {
+	v := new_validator()
+	_, known := incoterms[i.Code]
+
+	v.required("code", i.Code)
+	v.format("code", i.Code, known, "an Incoterms 2020 rule")
+	v.text("namedPlace", i.NamedPlace, MAX_NAME_LENGTH)
+
+	return v.result("Incoterm")
+}
+
+//	 documents - The documents each party must supply under the rule. The seller always supplies the commercial
+//				 invoice, the party clearing each border its declaration, the party contracting carriage the
+//				 transport document and the party obliged to insure the insurance certificate.
+func (r Responsibilities) documents() []DocumentResponsibility {
+	docs := []DocumentResponsibility{
+		{DT_SMRY_INVOICE, SELLER},
+		{DT_EXPORT_DECL, r.ExportClearance},
+		{DT_BILL_OF_LADING, r.MainCarriage},
+	}
+
+	if r.Insurance != "" {
+		docs = append(docs, DocumentResponsibility{DT_INSURANCE_CERT, r.Insurance})
+	}
+
+	return append(docs, DocumentResponsibility{DT_IMPORT_DECL, r.ImportClearance})
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Incoterms
+//==============================================================================================================================
+//	 set_trade_incoterm - Records the Incoterm of a trade. It cannot change once the trade has been declared.
+func (t *SimpleChaincode) set_trade_incoterm(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string,
+	tradeId string, code string, namedPlace string) ([]byte, error) {
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "set_trade_incoterm: Failed to retrieve Trade")
+	}
+
+	err = check_not_on_hold(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.check_trade_screening(stub, v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !is_enrolled_as(v, caller, SELLER) && !is_enrolled_as(v, caller, BUYER) {
+		return nil, permission_denied("set_trade_incoterm: Only the exporter or importer may set the Incoterm of trade " + tradeId)
+	}
+
+	if has_state(v, WS_TRADE_DECLARED) {
+		return nil, invalid_state("set_trade_incoterm: Trade " + tradeId + " has been declared, the Incoterm can no longer change")
+	}
+
+	v.Incoterm = &Incoterm{Code: strings.ToUpper(code), NamedPlace: namedPlace}
+
+	err = check_incoterm(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = t.save_trade(stub, v)
+
+	if err != nil {
+		fmt.Printf("set_trade_incoterm: Error saving changes: %s", err)
+		return nil, internal_error("set_trade_incoterm: Error saving changes", err)
+	}
+
+	return nil, nil
+}
+
+//	 get_trade_responsibilities - The responsibility matrix and risk transfer point of the trade's Incoterm, with
+//								  the documents each party owes and whether they are attached
+func (t *SimpleChaincode) get_trade_responsibilities(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, tradeId string) ([]byte, error) {
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "Failed to retrieve Trade")
+	}
+
+	if !t.can_read_trade(stub, v, caller) {
+		return nil, permission_denied("Caller " + caller + " is not permitted to read trade " + tradeId)
+	}
+
+	if v.Incoterm == nil {
+		return nil, not_found("Trade " + tradeId + " has no Incoterm")
+	}
+
+	r := incoterms[v.Incoterm.Code]
+
+	attached, err := t.attached_document_types(stub, v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []DocumentStatus
+
+	for _, d := range r.documents() {
+		docs = append(docs, DocumentStatus{d, attached[d.DocType]})
+	}
+
+	result := TradeResponsibilities{tradeId, *v.Incoterm, r, docs}
+
+	return json.Marshal(result)
+}
+
+//	 check_document_responsibility - A document the Incoterm assigns to a party can only be attached by a participant
+//									 enrolled in that relationship
+func (t *SimpleChaincode) check_document_responsibility(stub shim.ChaincodeStubInterface, v Trade, tDoc TradeDoc) error {
+
+	if v.Incoterm == nil {
+		return nil
+	}
+
+	docType, err := t.retrieve_document_type(stub, tDoc.DocId)
+
+	if err != nil {
+		return err
+	}
+
+	for _, d := range incoterms[v.Incoterm.Code].documents() {
+		if d.DocType == docType && !is_enrolled_as(v, tDoc.AddedBy, d.RelationshipType) {
+			return validation_error("Under " + v.Incoterm.Code + " document type " + docType + " must be supplied by the " + d.RelationshipType)
+		}
+	}
+
+	return nil
+}
+
+func (t *SimpleChaincode) retrieve_document_type(stub shim.ChaincodeStubInterface, docId string) (string, error) {
+
+	bytes, err := t.retrieve_document(stub, docId)
+
+	if err != nil || bytes == nil {
+		return "", wrap_error(err, "Failed to retrieve Document "+docId)
+	}
+
+	var doc struct {
+		Document `json:"document"`
+	}
+
+	err = json.Unmarshal(bytes, &doc)
+
+	if err != nil {
+		return "", internal_error("Corrupt document record "+docId, err)
+	}
+
+	return doc.Type, nil
+}
+
+//	 attached_document_types - The first document of each type attached to the trade
+func (t *SimpleChaincode) attached_document_types(stub shim.ChaincodeStubInterface, v Trade) (map[string]string, error) {
+
+	result := make(map[string]string)
+
+	for _, d := range v.Docs {
+		docType, err := t.retrieve_document_type(stub, d.DocId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, found := result[docType]; !found {
+			result[docType] = d.DocId
+		}
+	}
+
+	return result, nil
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+//	 check_incoterm - Validates the trade's Incoterm. Rules for sea and inland waterway transport need the route to
+//					  leave the port of shipment by sea.
+func check_incoterm(v Trade) error {
+	if v.Incoterm == nil {
+		return nil
+	}
+
+	err := v.Incoterm.validate()
+
+	if err != nil {
+		return err
+	}
+
+	if incoterms[v.Incoterm.Code].SeaOnly && len(v.Route) > 0 && v.Route[0].TransportMode != TM_SEA {
+		return validation_error("Incoterm " + v.Incoterm.Code + " can only be used when the goods leave the port of shipment by sea")
+	}
+
+	return nil
+}
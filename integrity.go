@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//Ledger keys
+const INTEGRITY_KEY_PREFIX = "INTEGRITY_"
+
+//HistoryKind
+const HK_STATE = "STATE"
+const HK_DOC = "DOC"
+const HK_ENROLMENT = "ENROLMENT"
+
+//ChainStatus
+const CS_INTACT = "INTACT"
+const CS_BROKEN = "BROKEN"
+const CS_UNCHAINED = "UNCHAINED"   // Saved before trade history was chained and not saved since, so there is nothing to verify
+const CS_UNANCHORED = "UNANCHORED" // Chained before the head was anchored; the chain is checked but truncation cannot be detected
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	HistoryEntry - A link in the trade's hash chain. Entry is the state, attachment or enrolment at Index of its list
+//				   as it was when the link was added; enrolments and attachments get a new link whenever they change.
+//				   Hash covers the previous link's hash and this link's content, so rewriting any earlier link
+//				   breaks every link after it.
+//==============================================================================================================================
+type HistoryEntry struct {
+	Seq      int             `json:"seq"`
+	Kind     string          `json:"kind"`
+	Index    int             `json:"index"`
+	Entry    json.RawMessage `json:"entry"`
+	PrevHash string          `json:"prevHash"`
+	Hash     string          `json:"hash"`
+}
+
+//	IntegrityAnchor - The chain's length and head hash, kept under INTEGRITY_<tradeId> apart from the trade record so
+//					  that truncating or replacing the trade's history is detected.
+type IntegrityAnchor struct {
+	TradeId  string `json:"tradeId"`
+	Links    int    `json:"links"`
+	HeadHash string `json:"headHash"`
+}
+
+type IntegrityReport struct {
+	TradeId     string `json:"tradeId"`
+	Status      string `json:"status"`
+	Valid       bool   `json:"valid"`
+	Links       int    `json:"links"`
+	HeadHash    string `json:"headHash"`
+	BrokenAtSeq int    `json:"brokenAtSeq"`
+	Reason      string `json:"reason"`
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Integrity
+//==============================================================================================================================
+//	 verify_trade_integrity - Recomputes the trade's hash chain and checks the live states, attachments and
+//							  enrolments against it. Reports the first broken link, or -1 when the chain holds.
+//							  The chain must end at the trade's anchor. A trade with neither a chain nor an anchor is
+//							  reported as unchained, it gets both on its next save.
+func (t *SimpleChaincode) verify_trade_integrity(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, tradeId string) ([]byte, error) {
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "Failed to retrieve Trade")
+	}
+
+	if !t.can_read_trade(stub, v, caller) {
+		return nil, permission_denied("Caller " + caller + " is not permitted to read trade " + tradeId)
+	}
+
+	anchor, anchored, err := t.retrieve_integrity_anchor(stub, tradeId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	report := IntegrityReport{TradeId: tradeId, Status: CS_INTACT, Valid: true, Links: len(v.History), BrokenAtSeq: -1}
+
+	if len(v.History) > 0 {
+		report.HeadHash = v.History[len(v.History)-1].Hash
+	}
+
+	if len(v.History) == 0 && !anchored {
+		report.Status = CS_UNCHAINED
+		report.Valid = false
+		report.Reason = "Trade was saved before its history was chained"
+
+		return json.Marshal(report)
+	}
+
+	seq, reason := verify_history(v)
+
+	if seq < 0 && anchored && (anchor.Links != len(v.History) || anchor.HeadHash != report.HeadHash) {
+		seq, reason = min_int(anchor.Links, len(v.History)), "Chain does not end at its anchor"
+	}
+
+	if seq >= 0 {
+		report.Status = CS_BROKEN
+		report.Valid = false
+		report.BrokenAtSeq = seq
+		report.Reason = reason
+	} else if !anchored {
+		report.Status = CS_UNANCHORED
+		report.Reason = "Chain was saved before its head was anchored"
+	}
+
+	return json.Marshal(report)
+}
+
+//	 anchor_trade_history - Records the head of the trade's chain. Called by save_trade after chaining.
+func (t *SimpleChaincode) anchor_trade_history(stub shim.ChaincodeStubInterface, v Trade) error {
+
+	anchor := IntegrityAnchor{TradeId: v.TradeId, Links: len(v.History)}
+
+	if len(v.History) > 0 {
+		anchor.HeadHash = v.History[len(v.History)-1].Hash
+	}
+
+	bytes, err := json.Marshal(anchor)
+
+	if err != nil {
+		return internal_error("Error converting integrity anchor", err)
+	}
+
+	err = stub.PutState(INTEGRITY_KEY_PREFIX+v.TradeId, bytes)
+
+	if err != nil {
+		return internal_error("Error storing integrity anchor", err)
+	}
+
+	return nil
+}
+
+func (t *SimpleChaincode) retrieve_integrity_anchor(stub shim.ChaincodeStubInterface, tradeId string) (IntegrityAnchor, bool, error) {
+
+	var anchor IntegrityAnchor
+
+	bytes, err := stub.GetState(INTEGRITY_KEY_PREFIX + tradeId)
+
+	if err != nil {
+		return anchor, false, internal_error("Unable to get integrity anchor for trade "+tradeId, err)
+	}
+
+	if bytes == nil {
+		return anchor, false, nil
+	}
+
+	err = json.Unmarshal(bytes, &anchor)
+
+	if err != nil {
+		return anchor, false, internal_error("Corrupt integrity anchor for trade "+tradeId, err)
+	}
+
+	return anchor, true, nil
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+//	 chain_trade_history - Adds a link for every state, attachment and enrolment that is new or has changed since its
+//						   last link. Called on every save so no path that changes a trade can skip the chain.
+func chain_trade_history(v *Trade) error {
+	live, err := history_snapshots(*v)
+
+	if err != nil {
+		return err
+	}
+
+	latest := latest_links(v.History)
+
+	for _, item := range live {
+		key := item.Kind + ":" + strconv.Itoa(item.Index)
+
+		if i, found := latest[key]; found && bytes.Equal(v.History[i].Entry, item.Entry) {
+			continue
+		}
+
+		link := HistoryEntry{Seq: len(v.History), Kind: item.Kind, Index: item.Index, Entry: item.Entry}
+
+		if link.Seq > 0 {
+			link.PrevHash = v.History[link.Seq-1].Hash
+		}
+
+		link.Hash = history_hash(link)
+
+		v.History = append(v.History, link)
+		latest[key] = link.Seq
+	}
+
+	return nil
+}
+
+//	 verify_history - Returns the sequence number of the first broken link and why, or -1
+func verify_history(v Trade) (int, string) {
+	seen := make(map[string]bool)
+	prev := ""
+
+	for i, link := range v.History {
+		if link.Seq != i {
+			return i, "Link is out of sequence"
+		}
+
+		if link.PrevHash != prev {
+			return i, "Link does not follow the previous link's hash"
+		}
+
+		if history_hash(link) != link.Hash {
+			return i, "Link content does not match its hash"
+		}
+
+		key := link.Kind + ":" + strconv.Itoa(link.Index)
+
+		if link.Kind == HK_STATE && seen[key] {
+			return i, "State " + strconv.Itoa(link.Index) + " has been rewritten"
+		}
+
+		seen[key] = true
+		prev = link.Hash
+	}
+
+	live, err := history_snapshots(v)
+
+	if err != nil {
+		return len(v.History), err.Error()
+	}
+
+	latest := latest_links(v.History)
+
+	for _, item := range live {
+		i, found := latest[item.Kind+":"+strconv.Itoa(item.Index)]
+
+		if !found {
+			return len(v.History), item.Kind + " " + strconv.Itoa(item.Index) + " is not in the chain"
+		}
+
+		if !bytes.Equal(v.History[i].Entry, item.Entry) {
+			return i, item.Kind + " " + strconv.Itoa(item.Index) + " differs from its chained entry"
+		}
+	}
+
+	if len(latest) != len(live) {
+		return len(v.History), "Chained entries have been removed from the trade"
+	}
+
+	return -1, ""
+}
+
+//	 history_snapshots - The trade's states, attachments and enrolments in chain order, with no hashes set
+func history_snapshots(v Trade) ([]HistoryEntry, error) {
+	var result []HistoryEntry
+
+	add := func(kind string, index int, entry interface{}) error {
+		b, err := json.Marshal(entry)
+
+		if err != nil {
+			return internal_error("Error converting "+kind+" "+strconv.Itoa(index)+" for the trade history", err)
+		}
+
+		result = append(result, HistoryEntry{Kind: kind, Index: index, Entry: b})
+		return nil
+	}
+
+	for i, s := range v.States {
+		if err := add(HK_STATE, i, s); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, d := range v.Docs {
+		if err := add(HK_DOC, i, d); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, tp := range v.Participants {
+		if err := add(HK_ENROLMENT, i, tp); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+//	 latest_links - Position of the latest link for each entry
+func latest_links(history []HistoryEntry) map[string]int {
+	latest := make(map[string]int)
+
+	for i, link := range history {
+		latest[link.Kind+":"+strconv.Itoa(link.Index)] = i
+	}
+
+	return latest
+}
+
+func history_hash(link HistoryEntry) string {
+	h := sha256.New()
+
+	h.Write([]byte(link.PrevHash + "|" + strconv.Itoa(link.Seq) + "|" + link.Kind + "|" + strconv.Itoa(link.Index) + "|"))
+	h.Write(link.Entry)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//KYCStatus
+const KS_UNVERIFIED = "UNVERIFIED"
+const KS_VERIFIED = "VERIFIED"
+const KS_REJECTED = "REJECTED"
+
+//RiskRating
+const RR_LOW = "LOW"
+const RR_MEDIUM = "MEDIUM"
+const RR_HIGH = "HIGH"
+
+//Ownership is expressed in basis points, so 100% is 10000
+const FULL_OWNERSHIP = 10000
+
+//Trade relationships that may only be taken by a participant with verified, unexpired KYC
+var kycRequiredRoles = map[string]bool{
+	TR_IMPORTER: true,
+	TR_EXPORTER: true,
+}
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+type KYCProfile struct {
+	LegalEntityId      string            `json:"legalEntityId"`
+	RegistrationNumber string            `json:"registrationNumber"`
+	TaxId              string            `json:"taxId"`
+	BeneficialOwners   []BeneficialOwner `json:"beneficialOwners"`
+	RiskRating         string            `json:"riskRating"`
+	Verification       KYCVerification   `json:"verification"`
+}
+
+type BeneficialOwner struct {
+	Name      string `json:"name"`
+	Country   string `json:"country"`
+	Ownership int64  `json:"ownership"`
+}
+
+type KYCVerification struct {
+	Status       string    `json:"status"`
+	VerifiedBy   string    `json:"verifiedBy"`
+	VerifiedDTTM time.Time `json:"verifiedDTTM"`
+	ExpiryDTTM   time.Time `json:"expiryDTTM"`
+	Note         string    `json:"note"`
+}
+
+//==============================================================================================================================
+//	 Validation
+//==============================================================================================================================
+func (k KYCProfile) validate() error {
+	v := new_validator()
+
+	v.format("legalEntityId", k.LegalEntityId, is_valid_lei(k.LegalEntityId), "a valid ISO 17442 LEI")
+	v.text("registrationNumber", k.RegistrationNumber, MAX_ID_LENGTH)
+	v.text("taxId", k.TaxId, MAX_ID_LENGTH)
+	v.required("riskRating", k.RiskRating)
+	v.one_of("riskRating", k.RiskRating, RR_LOW, RR_MEDIUM, RR_HIGH)
+	v.check("beneficialOwners", len(k.BeneficialOwners) > 0, VR_REQUIRED)
+
+	var total int64
+
+	for i, owner := range k.BeneficialOwners {
+		field := index_field("beneficialOwners", i)
+
+		v.text(field+".name", owner.Name, MAX_NAME_LENGTH)
+		v.required(field+".country", owner.Country)
+		v.positive(field+".ownership", owner.Ownership)
+
+		total += owner.Ownership
+	}
+
+	v.check("beneficialOwners", total <= FULL_OWNERSHIP, "must not own more than 100% in total")
+
+	return v.result("KYCProfile")
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - KYC
+//==============================================================================================================================
+//	 submit_kyc - Sets the participant's KYC profile. Any previous verification is discarded and the profile has to
+//				  be verified again.
+func (t *SimpleChaincode) submit_kyc(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, json_data []byte, participantId string) ([]byte, error) {
+
+	err := t.check_self_or_authority(stub, caller, participantId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var kyc KYCProfile
+
+	err = json.Unmarshal(json_data, &kyc)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for submit_kyc", err)
+	}
+
+	err = kyc.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range kyc.BeneficialOwners {
+		err = t.validate_country(stub, kyc.BeneficialOwners[i].Country)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	kyc.LegalEntityId = strings.ToUpper(kyc.LegalEntityId)
+	kyc.Verification = KYCVerification{Status: KS_UNVERIFIED}
+
+	return nil, t.save_kyc(stub, caller, participantId, kyc, "KYC profile submitted")
+}
+
+//	 verify_kyc - Records the outcome of a KYC review. Only authorities and banks may verify, and never themselves.
+func (t *SimpleChaincode) verify_kyc(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string,
+	participantId string, status string, expiry string, note string) ([]byte, error) {
+
+	if t.check_caller_type(stub, caller, PT_AUTHORITY) != nil && t.check_caller_type(stub, caller, PT_BANK) != nil {
+		return nil, permission_denied("verify_kyc: Only an authority or bank may verify KYC")
+	}
+
+	if caller == participantId {
+		return nil, permission_denied("verify_kyc: A participant cannot verify its own KYC")
+	}
+
+	if status != KS_VERIFIED && status != KS_REJECTED {
+		return nil, validation_error("verify_kyc: Status must be " + KS_VERIFIED + " or " + KS_REJECTED)
+	}
+
+	party, err := t.retrieve_participant_record(stub, participantId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if party.KYC == nil {
+		return nil, not_found("verify_kyc: Participant " + participantId + " has no KYC profile")
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	verification := KYCVerification{Status: status, VerifiedBy: caller, VerifiedDTTM: now, Note: note}
+
+	if status == KS_VERIFIED {
+		verification.ExpiryDTTM, err = time.Parse(time.RFC3339, expiry)
+
+		if err != nil || !verification.ExpiryDTTM.After(now) {
+			return nil, validation_error("verify_kyc: A future expiry date is required for verification")
+		}
+	}
+
+	kyc := *party.KYC
+	kyc.Verification = verification
+
+	err = t.save_kyc(stub, caller, participantId, kyc, note)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if t.is_authority(stub, caller) {
+		return nil, t.record_oversight(stub, caller, "verify_kyc", participantId, status+": "+note)
+	}
+
+	return nil, nil
+}
+
+func (t *SimpleChaincode) save_kyc(stub shim.ChaincodeStubInterface, caller string, participantId string, kyc KYCProfile, reason string) error {
+
+	record, err := t.retrieve_participant_fields(stub, participantId)
+
+	if err != nil {
+		return err
+	}
+
+	if participant_status(record) == PS_DEACTIVATED {
+		return invalid_state("Participant " + participantId + " is deactivated")
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return err
+	}
+
+	old := record["kyc"]
+	record["kyc"] = kyc
+
+	bytes, err := json.Marshal(record)
+
+	if err != nil {
+		return internal_error("Error converting participant record", err)
+	}
+
+	_, err = t.save_participant(stub, bytes, participantId)
+
+	if err != nil {
+		return err
+	}
+
+	return t.append_participant_history(stub, participantId, []ParticipantChange{{Field: "kyc", OldValue: old,
+		NewValue: kyc, Reason: reason, ChangedBy: caller, ChangeDTTM: now}})
+}
+
+//	 check_kyc_for_role - Refuses roles that need verified KYC when the profile is missing, unverified or expired
+func (t *SimpleChaincode) check_kyc_for_role(stub shim.ChaincodeStubInterface, participantId string, relationshipType string) error {
+
+	if !kycRequiredRoles[relationshipType] {
+		return nil
+	}
+
+	party, err := t.retrieve_participant_record(stub, participantId)
+
+	if err != nil {
+		return err
+	}
+
+	if party.KYC == nil {
+		return invalid_state("Participant " + participantId + " has no KYC profile, required for " + relationshipType)
+	}
+
+	if party.KYC.Verification.Status != KS_VERIFIED {
+		return invalid_state("Participant " + participantId + " KYC is " + party.KYC.Verification.Status + ", verification required for " + relationshipType)
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return err
+	}
+
+	if !party.KYC.Verification.ExpiryDTTM.After(now) {
+		return invalid_state("Participant " + participantId + " KYC expired on " + party.KYC.Verification.ExpiryDTTM.String())
+	}
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+//	 is_valid_lei - ISO 17442: 18 alphanumeric characters followed by two check digits, validated as ISO 7064 MOD 97-10
+func is_valid_lei(lei string) bool {
+	lei = strings.ToUpper(lei)
+
+	if len(lei) != 20 {
+		return false
+	}
+
+	digits := ""
+
+	for i, r := range lei {
+		switch {
+		case r >= '0' && r <= '9':
+			digits += string(r)
+		case r >= 'A' && r <= 'Z' && i < 18:
+			digits += big.NewInt(int64(r - 'A' + 10)).String()
+		default:
+			return false
+		}
+	}
+
+	n, ok := new(big.Int).SetString(digits, 10)
+
+	if !ok {
+		return false
+	}
+
+	return new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
@@ -0,0 +1,558 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//Currency that reports and limits are converted into
+const BASE_CURRENCY = "USD"
+
+//Currency of amounts recorded as bare integers of minor units, before amounts carried their currency
+const LEGACY_CURRENCY = BASE_CURRENCY
+
+//Ledger keys
+const MK_EXCHANGE_RATE = "KEY_EXCHANGE_RATE"
+const EXCHANGE_RATE_KEY_PREFIX = "FX_"
+
+//ISO 4217 currencies accepted by the chaincode and the number of digits in their minor unit
+var currencyMinorUnits = map[string]int{
+	"AED": 2,
+	"CNY": 2,
+	"INR": 2,
+	"USD": 2,
+	"GBP": 2,
+	"EUR": 2,
+	"JPY": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+}
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	Money - An exact amount held as an integer number of minor units (fils, fen, paise, cents, pence) of an ISO 4217
+//			currency. On the wire it is {"amount": "1234.50", "currency": "USD"} so no value ever passes through
+//			a float. A bare integer is read as minor units of LEGACY_CURRENCY, as recorded before amounts carried
+//			their currency. The zero value, with no currency, round trips as {"amount": "0", "currency": ""}.
+//==============================================================================================================================
+type Money struct {
+	MinorUnits int64
+	Currency   string
+}
+
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+//	ExchangeRateSeries - Published rates for one currency pair, ordered by effective date. Rate is a decimal string
+//						 giving how many units of To one unit of From buys.
+type ExchangeRateSeries struct {
+	From     string         `json:"from"`
+	To       string         `json:"to"`
+	Versions []ExchangeRate `json:"versions"`
+}
+
+type ExchangeRate struct {
+	Rate          string    `json:"rate"`
+	EffectiveDTTM time.Time `json:"effectiveDTTM"`
+}
+
+//	ExchangeRateRequest - The payload of add_exchange_rate
+type ExchangeRateRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	ExchangeRate
+}
+
+type ExchangeRate_Holder struct {
+	Pairs []string `json:"pairList"`
+}
+
+//==============================================================================================================================
+//	 Money Methods
+//==============================================================================================================================
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.String(), Currency: m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var legacy int64
+
+	if json.Unmarshal(data, &legacy) == nil {
+		*m = Money{MinorUnits: legacy, Currency: LEGACY_CURRENCY}
+		return nil
+	}
+
+	var mj moneyJSON
+
+	err := json.Unmarshal(data, &mj)
+
+	if err != nil {
+		return invalid_argument("Money must be an object with amount and currency", err)
+	}
+
+	if mj.Currency == "" && (mj.Amount == "" || mj.Amount == "0") {
+		*m = Money{}
+		return nil
+	}
+
+	parsed, err := parse_money(mj.Amount, mj.Currency)
+
+	if err != nil {
+		return err
+	}
+
+	*m = parsed
+	return nil
+}
+
+//	 String - The amount as an exact decimal in major units
+func (m Money) String() string {
+	digits, known := currencyMinorUnits[m.Currency]
+
+	if !known || digits == 0 {
+		return strconv.FormatInt(m.MinorUnits, 10)
+	}
+
+	sign := ""
+	units := m.MinorUnits
+
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+
+	s := strconv.FormatInt(units, 10)
+
+	for len(s) <= digits {
+		s = "0" + s
+	}
+
+	return sign + s[:len(s)-digits] + "." + s[len(s)-digits:]
+}
+
+func (m Money) validate() error {
+	if _, known := currencyMinorUnits[m.Currency]; !known {
+		return validation_error("Unsupported currency " + m.Currency)
+	}
+	return nil
+}
+
+func (r ExchangeRateRequest) validate() error {
+	v := new_validator()
+	_, fromKnown := currencyMinorUnits[r.From]
+	_, toKnown := currencyMinorUnits[r.To]
+	rate, ok := new(big.Rat).SetString(r.Rate)
+
+	v.required("from", r.From)
+	v.format("from", r.From, fromKnown, "a supported currency")
+	v.required("to", r.To)
+	v.format("to", r.To, toKnown, "a supported currency")
+	v.check("to", r.To == "" || r.To != r.From, "must differ from from")
+	v.required("rate", r.Rate)
+	v.format("rate", r.Rate, ok && rate.Sign() > 0, "a positive decimal")
+	v.required_time("effectiveDTTM", r.EffectiveDTTM)
+
+	return v.result("ExchangeRate")
+}
+
+func (m Money) isPositive() bool {
+	return m.validate() == nil && m.MinorUnits > 0
+}
+
+func (m Money) add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return m, validation_error("Cannot add " + o.Currency + " to " + m.Currency)
+	}
+
+	sum, err := to_minor_units(new(big.Int).Add(big.NewInt(m.MinorUnits), big.NewInt(o.MinorUnits)))
+
+	return Money{MinorUnits: sum, Currency: m.Currency}, err
+}
+
+func (m Money) times(quantity int64) (Money, error) {
+	product, err := to_minor_units(new(big.Int).Mul(big.NewInt(m.MinorUnits), big.NewInt(quantity)))
+
+	return Money{MinorUnits: product, Currency: m.Currency}, err
+}
+
+//	 applyRate - Amount multiplied by a basis point rate, rounded half up to the minor unit
+func (m Money) applyRate(rate int64) (Money, error) {
+	units, err := apply_rate(m.MinorUnits, rate)
+
+	return Money{MinorUnits: units, Currency: m.Currency}, err
+}
+
+//	 sum_money - All amounts must be in the currency of the first
+func sum_money(first Money, rest ...Money) (Money, error) {
+	total := first
+
+	for _, m := range rest {
+		var err error
+
+		total, err = total.add(m)
+
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+func zero_money(currency string) Money {
+	return Money{Currency: currency}
+}
+
+//	 parse_money - Parses a decimal amount exactly. More decimals than the currency's minor unit allows is an error
+//				   rather than being rounded away.
+func parse_money(amount string, currency string) (Money, error) {
+	var m Money
+
+	digits, known := currencyMinorUnits[currency]
+
+	if !known {
+		return m, validation_error("Unsupported currency " + currency)
+	}
+
+	amount = strings.TrimSpace(amount)
+
+	negative := strings.HasPrefix(amount, "-")
+	amount = strings.TrimPrefix(amount, "-")
+
+	parts := strings.Split(amount, ".")
+
+	if len(parts) > 2 || parts[0] == "" || (len(parts) == 2 && len(parts[1]) > digits) {
+		return m, validation_error("Invalid " + currency + " amount " + amount)
+	}
+
+	fraction := ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+	}
+
+	for len(fraction) < digits {
+		fraction += "0"
+	}
+
+	units, err := strconv.ParseInt(parts[0]+fraction, 10, 64)
+
+	if err != nil || !is_digits(parts[0]+fraction) {
+		return m, validation_error("Invalid " + currency + " amount " + amount)
+	}
+
+	if negative {
+		units = -units
+	}
+
+	m.MinorUnits = units
+	m.Currency = currency
+
+	return m, nil
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Exchange Rates
+//==============================================================================================================================
+//	 add_exchange_rate - Authority only. Publishes the rate for a currency pair from its effective date.
+func (t *SimpleChaincode) add_exchange_rate(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, json_data []byte) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var request ExchangeRateRequest
+
+	err = json.Unmarshal(json_data, &request)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for add_exchange_rate", err)
+	}
+
+	err = request.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	series, err := t.retrieve_exchange_rates(stub, request.From, request.To)
+
+	if err != nil {
+		return nil, err
+	}
+
+	i := len(series.Versions)
+
+	for j := len(series.Versions) - 1; j >= 0; j-- {
+		if series.Versions[j].EffectiveDTTM.Equal(request.EffectiveDTTM) {
+			return nil, conflict("add_exchange_rate: A rate is already effective from " + request.EffectiveDTTM.String())
+		}
+		if series.Versions[j].EffectiveDTTM.After(request.EffectiveDTTM) {
+			i = j
+		}
+	}
+
+	series.Versions = append(series.Versions, ExchangeRate{})
+	copy(series.Versions[i+1:], series.Versions[i:])
+	series.Versions[i] = request.ExchangeRate
+
+	bytes, err := json.Marshal(series)
+
+	if err != nil {
+		return nil, internal_error("Error converting exchange rate series", err)
+	}
+
+	key := EXCHANGE_RATE_KEY_PREFIX + request.From + "_" + request.To
+
+	err = stub.PutState(key, bytes)
+
+	if err != nil {
+		fmt.Printf("add_exchange_rate: Error saving changes: %s", err)
+		return nil, internal_error("add_exchange_rate: Error saving changes", err)
+	}
+
+	var holder ExchangeRate_Holder
+
+	err = t.get_holder(stub, MK_EXCHANGE_RATE, &holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !contains(holder.Pairs, key) {
+		holder.Pairs = append(holder.Pairs, key)
+
+		err = t.put_holder(stub, MK_EXCHANGE_RATE, holder)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, t.record_oversight(stub, caller, "add_exchange_rate", request.From+"/"+request.To,
+		request.Rate+" from "+request.EffectiveDTTM.String())
+}
+
+func (t *SimpleChaincode) retrieve_exchange_rates(stub shim.ChaincodeStubInterface, from string, to string) (ExchangeRateSeries, error) {
+
+	series := ExchangeRateSeries{From: from, To: to}
+
+	bytes, err := stub.GetState(EXCHANGE_RATE_KEY_PREFIX + from + "_" + to)
+
+	if err != nil {
+		return series, internal_error("Unable to get exchange rates for "+from+"/"+to, err)
+	}
+
+	if bytes == nil {
+		return series, nil
+	}
+
+	err = json.Unmarshal(bytes, &series)
+
+	if err != nil {
+		return series, internal_error("Corrupt exchange rates for "+from+"/"+to, err)
+	}
+
+	return series, nil
+}
+
+//	 get_exchange_rates - Every published series, or the one for the pair given as "FROM/TO"
+func (t *SimpleChaincode) get_exchange_rates(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, pair string) ([]byte, error) {
+
+	var holder ExchangeRate_Holder
+
+	err := t.get_holder(stub, MK_EXCHANGE_RATE, &holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := []ExchangeRateSeries{}
+
+	for _, key := range holder.Pairs {
+		currencies := strings.Split(strings.TrimPrefix(key, EXCHANGE_RATE_KEY_PREFIX), "_")
+
+		if len(currencies) != 2 || (pair != "" && pair != currencies[0]+"/"+currencies[1]) {
+			continue
+		}
+
+		series, err := t.retrieve_exchange_rates(stub, currencies[0], currencies[1])
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, series)
+	}
+
+	return json.Marshal(result)
+}
+
+//	 exchange_rate - The rate effective at the given time, using the pair directly, its inverse, or via the base
+//					 currency
+func (t *SimpleChaincode) exchange_rate(stub shim.ChaincodeStubInterface, from string, to string, at time.Time) (*big.Rat, error) {
+
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+
+	rate, err := t.direct_exchange_rate(stub, from, to, at)
+
+	if err == nil || from == BASE_CURRENCY || to == BASE_CURRENCY {
+		return rate, err
+	}
+
+	toBase, err := t.direct_exchange_rate(stub, from, BASE_CURRENCY, at)
+
+	if err != nil {
+		return nil, not_found("No exchange rate from " + from + " to " + to + " at " + at.String())
+	}
+
+	fromBase, err := t.direct_exchange_rate(stub, BASE_CURRENCY, to, at)
+
+	if err != nil {
+		return nil, not_found("No exchange rate from " + from + " to " + to + " at " + at.String())
+	}
+
+	return new(big.Rat).Mul(toBase, fromBase), nil
+}
+
+func (t *SimpleChaincode) direct_exchange_rate(stub shim.ChaincodeStubInterface, from string, to string, at time.Time) (*big.Rat, error) {
+
+	for _, inverse := range []bool{false, true} {
+		a, b := from, to
+		if inverse {
+			a, b = to, from
+		}
+
+		series, err := t.retrieve_exchange_rates(stub, a, b)
+
+		if err != nil {
+			return nil, err
+		}
+
+		var effective *ExchangeRate
+
+		for i := range series.Versions {
+			if series.Versions[i].EffectiveDTTM.After(at) {
+				break
+			}
+			effective = &series.Versions[i]
+		}
+
+		if effective == nil {
+			continue
+		}
+
+		rate, ok := new(big.Rat).SetString(effective.Rate)
+
+		if !ok || rate.Sign() <= 0 {
+			return nil, internal_error("Corrupt exchange rate for "+a+"/"+b, nil)
+		}
+
+		if inverse {
+			rate.Inv(rate)
+		}
+
+		return rate, nil
+	}
+
+	return nil, not_found("No exchange rate from " + from + " to " + to + " at " + at.String())
+}
+
+//	 convert_money - Converts at the rate effective at the given time, rounding half up to the target minor unit.
+//					 Returns the rate used so it can be recorded with the result.
+func (t *SimpleChaincode) convert_money(stub shim.ChaincodeStubInterface, m Money, to string, at time.Time) (Money, string, error) {
+
+	rate, err := t.exchange_rate(stub, m.Currency, to, at)
+
+	if err != nil {
+		return Money{}, "", err
+	}
+
+	converted, err := convert_at_rate(m, to, rate)
+
+	return converted, rate.FloatString(10), err
+}
+
+//	 to_base_currency
+func (t *SimpleChaincode) to_base_currency(stub shim.ChaincodeStubInterface, m Money, at time.Time) (Money, error) {
+
+	converted, _, err := t.convert_money(stub, m, BASE_CURRENCY, at)
+
+	return converted, err
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+func convert_at_rate(m Money, to string, rate *big.Rat) (Money, error) {
+	fromDigits, fromKnown := currencyMinorUnits[m.Currency]
+	toDigits, toKnown := currencyMinorUnits[to]
+
+	if !fromKnown || !toKnown {
+		return Money{}, validation_error("Unsupported currency pair " + m.Currency + "/" + to)
+	}
+
+	value := new(big.Rat).Mul(big.NewRat(m.MinorUnits, 1), rate)
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs_int(toDigits-fromDigits))), nil)
+
+	if toDigits >= fromDigits {
+		value.Mul(value, new(big.Rat).SetInt(scale))
+	} else {
+		value.Quo(value, new(big.Rat).SetInt(scale))
+	}
+
+	// Round half away from zero
+	num := new(big.Int).Set(value.Num())
+	den := value.Denom()
+	half := new(big.Int).Div(den, big.NewInt(2))
+
+	if num.Sign() < 0 {
+		num.Sub(num, half)
+	} else {
+		num.Add(num, half)
+	}
+
+	units, err := to_minor_units(new(big.Int).Quo(num, den))
+
+	return Money{MinorUnits: units, Currency: to}, err
+}
+
+//	 to_minor_units - Amounts are held in an int64; anything larger is refused rather than wrapping around
+func to_minor_units(i *big.Int) (int64, error) {
+	if i.BitLen() > 63 {
+		return 0, validation_error("Amount " + i.String() + " is out of range")
+	}
+	return i.Int64(), nil
+}
+
+func abs_int(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+func is_digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
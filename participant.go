@@ -0,0 +1,681 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//ParticipantStatus
+const PS_ACTIVE = "ACTIVE"
+const PS_SUSPENDED = "SUSPENDED"
+const PS_DEACTIVATED = "DEACTIVATED"
+
+//Ledger key prefix for the field-level change history of a participant
+const PARTICIPANT_HISTORY_KEY_PREFIX = "PARTY_HIST_"
+
+//Ledger key prefix for the trades a participant is enrolled on
+const PARTICIPANT_TRADES_KEY_PREFIX = "PARTY_TRADES_"
+
+//Page size used when a filter does not ask for one, and the largest page served
+const DEFAULT_PAGE_SIZE = 50
+const MAX_PAGE_SIZE = 500
+
+//Fields that update_participant may change, by participant type. Status and KYC have their own invokes.
+var updatableParticipantFields = map[string]bool{"primaryName": true, "address": true, "country": true}
+
+var updatableTypeFields = map[string]map[string]bool{
+	PT_AUTHORITY: {"jurisdiction": true, "mandate": true},
+}
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+type ParticipantChange struct {
+	Field      string      `json:"field"`
+	OldValue   interface{} `json:"oldValue"`
+	NewValue   interface{} `json:"newValue"`
+	Reason     string      `json:"reason"`
+	ChangedBy  string      `json:"changedBy"`
+	ChangeDTTM time.Time   `json:"changeDTTM"`
+}
+
+type ParticipantHistory struct {
+	ParticipantId string              `json:"participantId"`
+	Changes       []ParticipantChange `json:"changes"`
+}
+
+type ParticipantFilter struct {
+	Type     string `json:"type"`
+	Country  string `json:"country"`
+	Status   string `json:"status"`
+	Offset   int    `json:"offset"`
+	PageSize int    `json:"pageSize"`
+}
+
+type ParticipantPage struct {
+	Participants []json.RawMessage `json:"participants"`
+	Total        int               `json:"total"`
+	Offset       int               `json:"offset"`
+	NextOffset   int               `json:"nextOffset"`
+}
+
+type ParticipantTradeRef struct {
+	TradeId          string    `json:"tradeId"`
+	RelationshipType string    `json:"relationshipType"`
+	EnrolDTTM        time.Time `json:"enrolDTTM"`
+	Status           string    `json:"status"`
+}
+
+type ParticipantTrades struct {
+	ParticipantId string                `json:"participantId"`
+	Trades        []ParticipantTradeRef `json:"trades"`
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Participant Lifecycle
+//==============================================================================================================================
+//	 update_participant - Applies the fields in json_data to the participant and records each changed field.
+//						  Only the participant itself or an authority may update it, and any field outside the
+//						  updatable set for its type fails validation.
+func (t *SimpleChaincode) update_participant(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string,
+	json_data []byte, participantId string, reason string) ([]byte, error) {
+
+	err := t.check_self_or_authority(stub, caller, participantId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var changes map[string]interface{}
+
+	err = json.Unmarshal(json_data, &changes)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for update_participant", err)
+	}
+
+	record, err := t.retrieve_participant_fields(stub, participantId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if status, _ := record["status"].(string); status == PS_DEACTIVATED {
+		return nil, invalid_state("update_participant: Participant " + participantId + " is deactivated")
+	}
+
+	// Fields are checked and applied in a fixed order, at the transaction's time, so every peer records the same history
+	fields := make([]string, 0, len(changes))
+	for field := range changes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	partyType, _ := record["type"].(string)
+
+	v := new_validator()
+
+	for _, field := range fields {
+		v.check(field, updatableParticipantFields[field] || updatableTypeFields[partyType][field], VR_NOT_UPDATABLE)
+	}
+
+	err = v.result("Participant update")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var audit []ParticipantChange
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		value := changes[field]
+
+		old, _ := json.Marshal(record[field])
+		updated, _ := json.Marshal(value)
+
+		if string(old) == string(updated) {
+			continue
+		}
+
+		audit = append(audit, ParticipantChange{Field: field, OldValue: record[field], NewValue: value, Reason: reason,
+			ChangedBy: caller, ChangeDTTM: now})
+		record[field] = value
+	}
+
+	if len(audit) == 0 {
+		return nil, nil
+	}
+
+	bytes, err := json.Marshal(record)
+
+	if err != nil {
+		return nil, internal_error("update_participant: Error converting participant record", err)
+	}
+
+	participant, err := createParticipantFactory(bytes, partyType)
+
+	if err != nil {
+		return nil, wrap_error(err, "update_participant")
+	}
+
+	err = participant.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	party := participant.getParticipant()
+
+	err = t.validate_country(stub, party.Country)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, renamed := changes["primaryName"]
+	_, moved := changes["country"]
+
+	if renamed || moved {
+		screening, err := t.screen(stub, caller, "update_participant", "",
+			[]ScreeningSubject{{SubjectId: party.ParticipantID, Name: party.PrimaryName, Country: t.country_code(stub, party.Country)}}, nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if screening.Outcome == SO_BLOCKED {
+			logger.Warning("update_participant: Participant " + participantId + " blocked by screening " + screening.ScreeningId)
+			return json.Marshal(screening)
+		}
+	}
+
+	_, err = t.save_participant(stub, bytes, participantId)
+
+	if err != nil {
+		fmt.Printf("update_participant: Error saving changes: %s", err)
+		return nil, internal_error("update_participant: Error saving changes", err)
+	}
+
+	return nil, t.append_participant_history(stub, participantId, audit)
+}
+
+//	 suspend_participant - Authority only. Suspended participants can be reactivated.
+func (t *SimpleChaincode) suspend_participant(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, participantId string, reason string) ([]byte, error) {
+	return nil, t.change_participant_status(stub, caller, participantId, PS_SUSPENDED, reason, []string{PS_ACTIVE})
+}
+
+//	 reactivate_participant - Authority only
+func (t *SimpleChaincode) reactivate_participant(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, participantId string, reason string) ([]byte, error) {
+	return nil, t.change_participant_status(stub, caller, participantId, PS_ACTIVE, reason, []string{PS_SUSPENDED})
+}
+
+//	 deactivate_participant - Authority only. Deactivation is permanent.
+func (t *SimpleChaincode) deactivate_participant(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, participantId string, reason string) ([]byte, error) {
+	return nil, t.change_participant_status(stub, caller, participantId, PS_DEACTIVATED, reason, []string{PS_ACTIVE, PS_SUSPENDED})
+}
+
+func (t *SimpleChaincode) change_participant_status(stub shim.ChaincodeStubInterface, caller string, participantId string,
+	status string, reason string, allowedFrom []string) error {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return validation_error("A reason is required to change participant status")
+	}
+
+	record, err := t.retrieve_participant_fields(stub, participantId)
+
+	if err != nil {
+		return err
+	}
+
+	current := participant_status(record)
+
+	if !contains(allowedFrom, current) {
+		return invalid_state("Participant " + participantId + " cannot move from " + current + " to " + status)
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return err
+	}
+
+	record["status"] = status
+	record["statusReason"] = reason
+	record["statusDTTM"] = now
+
+	bytes, err := json.Marshal(record)
+
+	if err != nil {
+		return internal_error("Error converting participant record", err)
+	}
+
+	_, err = t.save_participant(stub, bytes, participantId)
+
+	if err != nil {
+		return err
+	}
+
+	err = t.append_participant_history(stub, participantId, []ParticipantChange{{Field: "status", OldValue: current,
+		NewValue: status, Reason: reason, ChangedBy: caller, ChangeDTTM: now}})
+
+	if err != nil {
+		return err
+	}
+
+	return t.record_oversight(stub, caller, "participant_status_"+status, participantId, reason)
+}
+
+//	 check_participant_active - Suspended and deactivated participants cannot join trades or attach documents
+func (t *SimpleChaincode) check_participant_active(stub shim.ChaincodeStubInterface, participantId string) error {
+
+	record, err := t.retrieve_participant_fields(stub, participantId)
+
+	if err != nil {
+		return err
+	}
+
+	status := participant_status(record)
+
+	if status != PS_ACTIVE {
+		return invalid_state("Participant " + participantId + " is " + status)
+	}
+
+	return nil
+}
+
+//	 check_self_or_authority - The caller must be the participant itself or an authority
+func (t *SimpleChaincode) check_self_or_authority(stub shim.ChaincodeStubInterface, caller string, participantId string) error {
+
+	if caller != "" && (caller == participantId || t.is_authority(stub, caller)) {
+		return nil
+	}
+
+	return permission_denied("Caller " + caller + " may not act for participant " + participantId)
+}
+
+//	 can_see_private - The participant itself, authorities and banks may see a participant's KYC and history
+func (t *SimpleChaincode) can_see_private(stub shim.ChaincodeStubInterface, caller string, participantId string) bool {
+
+	return caller != "" && (caller == participantId || t.is_authority(stub, caller) || t.check_caller_type(stub, caller, PT_BANK) == nil)
+}
+
+//	 participant_view - The stored participant as the caller may see it, without the KYC profile unless can_see_private
+func (t *SimpleChaincode) participant_view(stub shim.ChaincodeStubInterface, caller string, participantId string, bytes []byte) ([]byte, error) {
+
+	if t.can_see_private(stub, caller, participantId) {
+		return bytes, nil
+	}
+
+	var fields map[string]interface{}
+
+	err := json.Unmarshal(bytes, &fields)
+
+	if err != nil {
+		return nil, internal_error("Corrupt participant record "+participantId, err)
+	}
+
+	if _, ok := fields["kyc"]; !ok {
+		return bytes, nil
+	}
+
+	delete(fields, "kyc")
+
+	return json.Marshal(fields)
+}
+
+//	 retrieve_participant_fields - The stored participant decoded generically so type-specific fields are kept
+func (t *SimpleChaincode) retrieve_participant_fields(stub shim.ChaincodeStubInterface, participantId string) (map[string]interface{}, error) {
+
+	bytes, err := t.retrieve_participant(stub, participantId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes == nil {
+		return nil, not_found("Participant " + participantId + " does not exist")
+	}
+
+	var record map[string]interface{}
+
+	err = json.Unmarshal(bytes, &record)
+
+	if err != nil {
+		return nil, internal_error("Corrupt participant record "+participantId, err)
+	}
+
+	return record, nil
+}
+
+func (t *SimpleChaincode) append_participant_history(stub shim.ChaincodeStubInterface, participantId string, changes []ParticipantChange) error {
+
+	history, err := t.retrieve_participant_history(stub, participantId)
+
+	if err != nil {
+		return err
+	}
+
+	history.Changes = append(history.Changes, changes...)
+
+	bytes, err := json.Marshal(history)
+
+	if err != nil {
+		return internal_error("Error converting participant history", err)
+	}
+
+	err = stub.PutState(PARTICIPANT_HISTORY_KEY_PREFIX+participantId, bytes)
+
+	if err != nil {
+		fmt.Printf("PARTICIPANT_HISTORY: Error storing participant history: %s", err)
+		return internal_error("Error storing participant history", err)
+	}
+
+	return nil
+}
+
+func (t *SimpleChaincode) retrieve_participant_history(stub shim.ChaincodeStubInterface, participantId string) (ParticipantHistory, error) {
+
+	history := ParticipantHistory{ParticipantId: participantId, Changes: []ParticipantChange{}}
+
+	bytes, err := stub.GetState(PARTICIPANT_HISTORY_KEY_PREFIX + participantId)
+
+	if err != nil {
+		return history, internal_error("Unable to get participant history for "+participantId, err)
+	}
+
+	if bytes == nil {
+		return history, nil
+	}
+
+	err = json.Unmarshal(bytes, &history)
+
+	if err != nil {
+		return history, internal_error("Corrupt participant history for "+participantId, err)
+	}
+
+	return history, nil
+}
+
+//	 get_participant_history - Visible to the participant itself, authorities and banks
+func (t *SimpleChaincode) get_participant_history(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, participantId string) ([]byte, error) {
+
+	if !t.can_see_private(stub, caller, participantId) {
+		return nil, permission_denied("get_participant_history: Caller " + caller + " may not see the history of participant " + participantId)
+	}
+
+	history, err := t.retrieve_participant_history(stub, participantId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(history)
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Participant Search and Trade Index
+//==============================================================================================================================
+//	 search_participants - Participants matching every filter field that is set, one page at a time. NextOffset is
+//						   -1 on the last page.
+func (t *SimpleChaincode) search_participants(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, filter_json string) ([]byte, error) {
+
+	var filter ParticipantFilter
+
+	err := json.Unmarshal([]byte(filter_json), &filter)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON filter provided for get_participants", err)
+	}
+
+	err = filter.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.PageSize == 0 {
+		filter.PageSize = DEFAULT_PAGE_SIZE
+	}
+
+	if filter.Country != "" {
+		filter.Country = t.country_code(stub, filter.Country)
+	}
+
+	var participants Participant_Holder
+
+	err = t.get_holder(stub, MK_PARTICIPANT, &participants)
+
+	if err != nil {
+		return nil, err
+	}
+
+	page := ParticipantPage{Participants: []json.RawMessage{}, Offset: filter.Offset, NextOffset: -1}
+
+	for _, participantId := range participants.ParticipantId {
+		bytes, err := t.retrieve_participant(stub, participantId)
+
+		if err != nil || bytes == nil {
+			return nil, wrap_error(err, "Failed to retrieve Participant")
+		}
+
+		var party Participant
+
+		err = json.Unmarshal(bytes, &party)
+
+		if err != nil {
+			return nil, internal_error("Corrupt participant record "+participantId, err)
+		}
+
+		if filter.Type != "" && party.Type != filter.Type {
+			continue
+		}
+
+		if filter.Country != "" && t.country_code(stub, party.Country) != filter.Country {
+			continue
+		}
+
+		status := party.Status
+		if status == "" {
+			status = PS_ACTIVE
+		}
+
+		if filter.Status != "" && status != filter.Status {
+			continue
+		}
+
+		if page.Total >= filter.Offset && len(page.Participants) < filter.PageSize {
+			bytes, err = t.participant_view(stub, caller, participantId, bytes)
+
+			if err != nil {
+				return nil, err
+			}
+
+			page.Participants = append(page.Participants, json.RawMessage(bytes))
+		}
+
+		page.Total++
+	}
+
+	if filter.Offset+len(page.Participants) < page.Total {
+		page.NextOffset = filter.Offset + len(page.Participants)
+	}
+
+	return json.Marshal(page)
+}
+
+//	 index_participant_trade - Records the enrolment, or its latest status, in the participant's reverse trade index
+func (t *SimpleChaincode) index_participant_trade(stub shim.ChaincodeStubInterface, tradeId string, tp TradeParticipant) error {
+
+	index, err := t.retrieve_participant_trades(stub, tp.ParticipantID)
+
+	if err != nil {
+		return err
+	}
+
+	ref := ParticipantTradeRef{TradeId: tradeId, RelationshipType: tp.RelationshipType, EnrolDTTM: tp.EnrolDTTM, Status: tp.Status}
+	found := false
+
+	for i := range index.Trades {
+		if index.Trades[i].TradeId == tradeId && index.Trades[i].RelationshipType == tp.RelationshipType {
+			index.Trades[i] = ref
+			found = true
+		}
+	}
+
+	if !found {
+		index.Trades = append(index.Trades, ref)
+	}
+
+	bytes, err := json.Marshal(index)
+
+	if err != nil {
+		return internal_error("Error converting participant trade index", err)
+	}
+
+	err = stub.PutState(PARTICIPANT_TRADES_KEY_PREFIX+tp.ParticipantID, bytes)
+
+	if err != nil {
+		fmt.Printf("INDEX_PARTICIPANT_TRADE: Error storing participant trade index: %s", err)
+		return internal_error("Error storing participant trade index", err)
+	}
+
+	return nil
+}
+
+func (t *SimpleChaincode) retrieve_participant_trades(stub shim.ChaincodeStubInterface, participantId string) (ParticipantTrades, error) {
+
+	index := ParticipantTrades{ParticipantId: participantId, Trades: []ParticipantTradeRef{}}
+
+	bytes, err := stub.GetState(PARTICIPANT_TRADES_KEY_PREFIX + participantId)
+
+	if err != nil {
+		return index, internal_error("Unable to get participant trade index for "+participantId, err)
+	}
+
+	if bytes == nil {
+		return index, nil
+	}
+
+	err = json.Unmarshal(bytes, &index)
+
+	if err != nil {
+		return index, internal_error("Corrupt participant trade index for "+participantId, err)
+	}
+
+	return index, nil
+}
+
+//	 get_trades_for_participant - Trades the participant is on with their relationship types. Visible to the
+//								  participant itself and to authorities.
+func (t *SimpleChaincode) get_trades_for_participant(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, participantId string) ([]byte, error) {
+
+	err := t.check_self_or_authority(stub, caller, participantId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := t.retrieve_participant_trades(stub, participantId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(index)
+}
+
+//	 rebuild_participant_trade_index - Authority only. Indexes enrolments on trades created before the index existed.
+func (t *SimpleChaincode) rebuild_participant_trade_index(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var trades Trade_Holder
+
+	err = t.get_holder(stub, MK_TRADE, &trades)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tradeId := range trades.TradeId {
+		v, err := t.retrieve_trade(stub, tradeId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tp := range v.Participants {
+			err = t.index_participant_trade(stub, tradeId, tp)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return nil, t.record_oversight(stub, caller, "rebuild_participant_trade_index", "", "")
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+func (f ParticipantFilter) validate() error {
+	v := new_validator()
+
+	v.one_of("type", f.Type, participantTypes...)
+	v.one_of("status", f.Status, PS_ACTIVE, PS_SUSPENDED, PS_DEACTIVATED)
+	v.paging(f.Offset, f.PageSize)
+
+	return v.result("ParticipantFilter")
+}
+
+//	 participant_status - Participants created before statuses existed are active
+func participant_status(record map[string]interface{}) string {
+	status, _ := record["status"].(string)
+
+	if status == "" {
+		return PS_ACTIVE
+	}
+
+	return status
+}
+
+//	 set_participant_fields - Overwrites top-level fields of a participant JSON record
+func set_participant_fields(participant_json []byte, fields map[string]interface{}) ([]byte, error) {
+	var record map[string]interface{}
+
+	err := json.Unmarshal(participant_json, &record)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range fields {
+		record[k] = v
+	}
+
+	return json.Marshal(record)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//PortEvent
+const PE_VESSEL_ARRIVAL = "VSLARR"
+const PE_BERTHING = "BERTH"
+const PE_DISCHARGE = "DSCHRG"
+const PE_GATE_IN = "GATEIN"
+const PE_GATE_OUT = "GATEOUT"
+const PE_RELEASE = "RLSE"
+
+//Port events about the vessel rather than individual containers
+var vesselEvents = map[string]bool{
+	PE_VESSEL_ARRIVAL: true,
+	PE_BERTHING:       true,
+}
+
+//Port events about individual containers
+var containerEvents = map[string]bool{
+	PE_DISCHARGE: true,
+	PE_GATE_IN:   true,
+	PE_RELEASE:   true,
+	PE_GATE_OUT:  true,
+}
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+type PortEvent struct {
+	PortId       string    `json:"portId"`
+	EventType    string    `json:"eventType"`
+	ContainerNos []string  `json:"containerNos"`
+	VesselName   string    `json:"vesselName"`
+	VoyageRef    string    `json:"voyageRef"`
+	EventDTTM    time.Time `json:"eventDTTM"`
+	Note         string    `json:"note"`
+	RecordedBy   string    `json:"recordedBy"`
+	RecordDTTM   time.Time `json:"recordDTTM"`
+}
+
+//==============================================================================================================================
+//	 Validation
+//==============================================================================================================================
+func (event PortEvent) validate() error {
+	v := new_validator()
+
+	v.identifier("portId", event.PortId)
+	v.required("eventType", event.EventType)
+	v.format("eventType", event.EventType, vesselEvents[event.EventType] || containerEvents[event.EventType], "a known port event")
+	v.check("containerNos", !containerEvents[event.EventType] || len(event.ContainerNos) > 0, "is required for "+event.EventType)
+	v.required_time("eventDTTM", event.EventDTTM)
+	v.max_length("note", event.Note, MAX_TEXT_LENGTH)
+
+	return v.result("PortEvent")
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Port Events
+//==============================================================================================================================
+//	 record_port_event - A port records an operational event for the trade's vessel or containers. Vessel arrival
+//						 also completes the route leg into the port. At the destination port, vessel arrival moves
+//						 the trade to arrived and release to released, when the state rules allow it.
+func (t *SimpleChaincode) record_port_event(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, json_data []byte, tradeId string) ([]byte, error) {
+
+	var event PortEvent
+
+	err := json.Unmarshal(json_data, &event)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for record_port_event", err)
+	}
+
+	err = event.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if caller != event.PortId {
+		return nil, permission_denied("record_port_event: Only port " + event.PortId + " may record its own events")
+	}
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "record_port_event: Failed to retrieve Trade")
+	}
+
+	err = check_acting_participant(v, event.PortId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.check_trade_screening(stub, v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !is_enrolled_as(v, event.PortId, TR_ORGN_PORT) && !is_enrolled_as(v, event.PortId, TR_TRNST_PORT) && !is_enrolled_as(v, event.PortId, TR_DEST_PORT) {
+		return nil, validation_error("record_port_event: " + event.PortId + " is not a port on trade " + tradeId)
+	}
+
+	for i := range event.ContainerNos {
+		event.ContainerNos[i] = normalise_container_no(event.ContainerNos[i])
+	}
+
+	switch {
+	case vesselEvents[event.EventType], containerEvents[event.EventType]:
+		err = check_containers_on_trade(v, event.ContainerNos)
+	default:
+		return nil, validation_error("record_port_event: Unknown port event " + event.EventType)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	destination := is_enrolled_as(v, event.PortId, TR_DEST_PORT)
+
+	if event.EventType == PE_GATE_OUT && destination {
+		for _, no := range event.ContainerNos {
+			c := v.Containers[find_container(v, no)]
+
+			if c.Status != PE_RELEASE || c.StatusPort != event.PortId {
+				return nil, invalid_state("record_port_event: Container " + no + " has not been released at " + event.PortId)
+			}
+		}
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if event.EventType == PE_VESSEL_ARRIVAL && has_open_leg_into(v, event.PortId) {
+		call, err := apply_port_call(&v, event.PortId, PC_ARRIVAL, event.EventDTTM)
+
+		if err != nil {
+			return nil, err
+		}
+
+		call.RecordedBy = caller
+		call.RecordDTTM = now
+		v.PortCalls = append(v.PortCalls, call)
+	}
+
+	for _, no := range event.ContainerNos {
+		v.Containers[find_container(v, no)].setStatus(event.EventType, event.PortId, event.EventDTTM)
+	}
+
+	event.RecordedBy = caller
+	event.RecordDTTM = now
+
+	v.PortEvents = append(v.PortEvents, event)
+
+	if destination {
+		state := ""
+
+		if event.EventType == PE_VESSEL_ARRIVAL {
+			state = WS_CARGO_ARRIVED
+		} else if event.EventType == PE_RELEASE && all_containers_at(v, PE_RELEASE, event.PortId) {
+			state = WS_CARGO_RELEASED
+		}
+
+		if state != "" && check_state_transition(v, state) == nil && t.check_document_checklist(stub, v, state) == nil {
+			add_trade_state(&v, state, now)
+		}
+	}
+
+	_, err = t.save_trade(stub, v)
+
+	if err != nil {
+		fmt.Printf("record_port_event: Error saving changes: %s", err)
+		return nil, internal_error("record_port_event: Error saving changes", err)
+	}
+
+	return nil, nil
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+//	 check_state_transition - The rules for moving a trade into a state. Arrival can only be recorded once and release
+//							  needs the cargo to have arrived and the trade to be cleared.
+func check_state_transition(v Trade, state string) error {
+	err := check_not_on_hold(v)
+
+	if err != nil {
+		return err
+	}
+
+	switch state {
+	case WS_CARGO_ARRIVED:
+		if has_state(v, WS_CARGO_ARRIVED) {
+			return invalid_state("Trade " + v.TradeId + " has already arrived")
+		}
+	case WS_CARGO_RELEASED:
+		if has_state(v, WS_CARGO_RELEASED) {
+			return invalid_state("Trade " + v.TradeId + " has already been released")
+		}
+		if !has_state(v, WS_CARGO_ARRIVED) || !has_state(v, WS_TRADE_CLEARED) {
+			return invalid_state("Trade " + v.TradeId + " must have arrived and been cleared before release")
+		}
+	}
+
+	return nil
+}
+
+func check_containers_on_trade(v Trade, containerNos []string) error {
+	for _, no := range containerNos {
+		if find_container(v, no) < 0 {
+			return validation_error("Container " + no + " is not on trade " + v.TradeId)
+		}
+	}
+	return nil
+}
+
+//	 all_containers_at - True when every container of the trade last had the given event at the port
+func all_containers_at(v Trade, eventType string, portId string) bool {
+	for _, c := range v.Containers {
+		if c.Status != eventType || c.StatusPort != portId {
+			return false
+		}
+	}
+	return true
+}
+
+func has_open_leg_into(v Trade, portId string) bool {
+	for _, l := range v.Route {
+		if l.ToPort == portId && l.ActualArrivalDTTM.IsZero() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//TransportMode
+const TM_SEA = "SEA"
+const TM_AIR = "AIR"
+const TM_ROAD = "ROAD"
+const TM_RAIL = "RAIL"
+
+//PortCallEvent
+const PC_ARRIVAL = "ARRIVAL"
+const PC_DEPARTURE = "DEPARTURE"
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	RouteLeg - One movement of the shipment between two ports. Ports are participant IDs: the first leg leaves the
+//			   origin port, the last arrives at the destination port and every port in between is a transit port.
+//			   Actual times are filled in from the ports' own call events.
+//==============================================================================================================================
+type RouteLeg struct {
+	LegNum               int       `json:"legNum"`
+	FromPort             string    `json:"fromPort"`
+	ToPort               string    `json:"toPort"`
+	TransportMode        string    `json:"transportMode"`
+	Carrier              string    `json:"carrier"`
+	VoyageRef            string    `json:"voyageRef"`
+	PlannedDepartureDTTM time.Time `json:"plannedDepartureDTTM"`
+	PlannedArrivalDTTM   time.Time `json:"plannedArrivalDTTM"`
+	ActualDepartureDTTM  time.Time `json:"actualDepartureDTTM"`
+	ActualArrivalDTTM    time.Time `json:"actualArrivalDTTM"`
+}
+
+type PortCall struct {
+	PortId     string    `json:"portId"`
+	LegNum     int       `json:"legNum"`
+	EventType  string    `json:"eventType"`
+	EventDTTM  time.Time `json:"eventDTTM"`
+	RecordedBy string    `json:"recordedBy"`
+	RecordDTTM time.Time `json:"recordDTTM"`
+}
+
+//	RouteView - The route of a trade with where the shipment is now and when it is expected at destination. The
+//				ETA is the planned arrival of the last leg moved by the delay of the most recent actual event.
+type RouteView struct {
+	TradeId     string     `json:"tradeId"`
+	Legs        []RouteLeg `json:"legs"`
+	PortCalls   []PortCall `json:"portCalls"`
+	CurrentLeg  int        `json:"currentLeg"`
+	LastPort    string     `json:"lastPort"`
+	LastEvent   string     `json:"lastEvent"`
+	Arrived     bool       `json:"arrived"`
+	DelayMins   int64      `json:"delayMins"`
+	ETADTTM     time.Time  `json:"etaDTTM"`
+	PlannedDTTM time.Time  `json:"plannedDTTM"`
+}
+
+//==============================================================================================================================
+//	 Validation
+//==============================================================================================================================
+func (l RouteLeg) validate() error {
+	v := new_validator()
+
+	v.positive("legNum", int64(l.LegNum))
+	v.identifier("fromPort", l.FromPort)
+	v.identifier("toPort", l.ToPort)
+	v.check("toPort", l.ToPort == "" || l.ToPort != l.FromPort, "must differ from fromPort")
+	v.required("transportMode", l.TransportMode)
+	v.one_of("transportMode", l.TransportMode, TM_SEA, TM_AIR, TM_ROAD, TM_RAIL)
+	v.text("carrier", l.Carrier, MAX_NAME_LENGTH)
+	v.required_time("plannedDepartureDTTM", l.PlannedDepartureDTTM)
+	v.required_time("plannedArrivalDTTM", l.PlannedArrivalDTTM)
+	v.ordered("plannedDepartureDTTM", l.PlannedDepartureDTTM, "plannedArrivalDTTM", l.PlannedArrivalDTTM)
+	v.ordered("actualDepartureDTTM", l.ActualDepartureDTTM, "actualArrivalDTTM", l.ActualArrivalDTTM)
+
+	return v.result("RouteLeg")
+}
+
+//	 validate_route - Legs must be numbered from 1, join up port to port and run from the enrolled origin port
+//					  through enrolled transit ports to the enrolled destination port.
+func validate_route(v Trade, legs []RouteLeg) error {
+	rules := new_validator()
+
+	rules.check("route", len(legs) > 0, "must have at least one leg")
+
+	for i, l := range legs {
+		field := index_field("route", i)
+
+		rules.nested(field, l.validate())
+		rules.check(field+".legNum", l.LegNum == i+1, "must be "+strconv.Itoa(i+1)+", legs are numbered in order from 1")
+
+		if i > 0 {
+			previous := index_field("route", i-1)
+
+			rules.check(field+".fromPort", legs[i-1].ToPort == l.FromPort, "must be "+previous+".toPort")
+			rules.check(field+".plannedDepartureDTTM", !l.PlannedDepartureDTTM.Before(legs[i-1].PlannedArrivalDTTM),
+				"must not be before "+previous+".plannedArrivalDTTM")
+		}
+	}
+
+	err := rules.result("Route")
+
+	if err != nil {
+		return err
+	}
+
+	for i, l := range legs {
+		relationship := TR_TRNST_PORT
+		if i == 0 {
+			relationship = TR_ORGN_PORT
+		}
+
+		if !is_enrolled_as(v, l.FromPort, relationship) {
+			return invalid_state("Port " + l.FromPort + " is not enrolled on trade " + v.TradeId + " as " + relationship)
+		}
+	}
+
+	last := legs[len(legs)-1]
+
+	if !is_enrolled_as(v, last.ToPort, TR_DEST_PORT) {
+		return invalid_state("Port " + last.ToPort + " is not enrolled on trade " + v.TradeId + " as " + TR_DEST_PORT)
+	}
+
+	return nil
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Route
+//==============================================================================================================================
+//	 set_trade_route - Sets the planned route of a trade. Legs the shipment has already departed on cannot change,
+//					   so a re-route only replaces the legs still ahead.
+func (t *SimpleChaincode) set_trade_route(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, json_data []byte, tradeId string) ([]byte, error) {
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "set_trade_route: Failed to retrieve Trade")
+	}
+
+	err = check_not_on_hold(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.check_trade_screening(stub, v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !t.is_authority(stub, caller) && check_acting_participant(v, caller) != nil {
+		return nil, permission_denied("Caller " + caller + " may not change the route of trade " + tradeId)
+	}
+
+	var legs []RouteLeg
+
+	err = json.Unmarshal(json_data, &legs)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for set_trade_route", err)
+	}
+
+	for i := range legs {
+		legs[i].ActualDepartureDTTM = time.Time{}
+		legs[i].ActualArrivalDTTM = time.Time{}
+	}
+
+	for _, old := range v.Route {
+		if old.ActualDepartureDTTM.IsZero() {
+			continue
+		}
+
+		i := old.LegNum - 1
+
+		if i >= len(legs) || legs[i].FromPort != old.FromPort || legs[i].ToPort != old.ToPort ||
+			legs[i].TransportMode != old.TransportMode || legs[i].Carrier != old.Carrier {
+			return nil, invalid_state("set_trade_route: Leg " + strconv.Itoa(old.LegNum) + " has departed and cannot change")
+		}
+
+		legs[i] = old
+	}
+
+	err = validate_route(v, legs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	v.Route = legs
+
+	err = check_incoterm(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = t.save_trade(stub, v)
+
+	if err != nil {
+		fmt.Printf("set_trade_route: Error saving changes: %s", err)
+		return nil, internal_error("set_trade_route: Error saving changes", err)
+	}
+
+	return nil, nil
+}
+
+//	 record_port_call - A port records the shipment arriving at or departing from it. Only the port itself may record
+//						its calls, and the leg's actual times are updated from them.
+func (t *SimpleChaincode) record_port_call(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string,
+	tradeId string, portId string, eventType string, eventDTTM string) ([]byte, error) {
+
+	if caller != portId {
+		return nil, permission_denied("record_port_call: Only port " + portId + " may record its own port calls")
+	}
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "record_port_call: Failed to retrieve Trade")
+	}
+
+	err = check_acting_participant(v, portId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.check_trade_screening(stub, v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	at, err := time.Parse(time.RFC3339, eventDTTM)
+
+	if err != nil {
+		return nil, invalid_argument("record_port_call: Invalid event date "+eventDTTM, err)
+	}
+
+	call, err := apply_port_call(&v, portId, eventType, at)
+
+	if err != nil {
+		return nil, err
+	}
+
+	call.RecordedBy = caller
+	call.RecordDTTM, err = tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	v.PortCalls = append(v.PortCalls, call)
+
+	_, err = t.save_trade(stub, v)
+
+	if err != nil {
+		fmt.Printf("record_port_call: Error saving changes: %s", err)
+		return nil, internal_error("record_port_call: Error saving changes", err)
+	}
+
+	return nil, nil
+}
+
+//	 get_trade_route - The route, port calls and ETA of a trade
+func (t *SimpleChaincode) get_trade_route(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, tradeId string) ([]byte, error) {
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "Failed to retrieve Trade")
+	}
+
+	if !t.can_read_trade(stub, v, caller) {
+		return nil, permission_denied("Caller " + caller + " is not permitted to read trade " + tradeId)
+	}
+
+	return json.Marshal(route_view(v))
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+//	 apply_port_call - Finds the leg the call belongs to and sets its actual time. A departure is from the first leg
+//					   leaving the port not yet departed, an arrival to the first leg into the port not yet arrived.
+func apply_port_call(v *Trade, portId string, eventType string, at time.Time) (PortCall, error) {
+	call := PortCall{PortId: portId, EventType: eventType, EventDTTM: at}
+
+	for i := range v.Route {
+		l := &v.Route[i]
+
+		switch {
+		case eventType == PC_DEPARTURE && l.FromPort == portId && l.ActualDepartureDTTM.IsZero():
+			if i > 0 && v.Route[i-1].ActualArrivalDTTM.IsZero() {
+				return call, invalid_state("Cannot depart " + portId + " before arriving there")
+			}
+			l.ActualDepartureDTTM = at
+		case eventType == PC_ARRIVAL && l.ToPort == portId && l.ActualArrivalDTTM.IsZero():
+			if l.ActualDepartureDTTM.IsZero() {
+				return call, invalid_state("Cannot arrive at " + portId + " before departing " + l.FromPort)
+			}
+			if at.Before(l.ActualDepartureDTTM) {
+				return call, invalid_state("Arrival at " + portId + " is before departure from " + l.FromPort)
+			}
+			l.ActualArrivalDTTM = at
+		default:
+			continue
+		}
+
+		call.LegNum = l.LegNum
+		return call, nil
+	}
+
+	if eventType != PC_ARRIVAL && eventType != PC_DEPARTURE {
+		return call, validation_error("Unknown port call event " + eventType)
+	}
+
+	return call, invalid_state("No open leg on the route of trade " + v.TradeId + " for " + eventType + " at " + portId)
+}
+
+func route_view(v Trade) RouteView {
+	view := RouteView{TradeId: v.TradeId, Legs: v.Route, PortCalls: v.PortCalls}
+
+	if len(v.Route) == 0 {
+		return view
+	}
+
+	var delay time.Duration
+
+	for _, l := range v.Route {
+		if !l.ActualDepartureDTTM.IsZero() {
+			view.CurrentLeg = l.LegNum
+			view.LastPort = l.FromPort
+			view.LastEvent = PC_DEPARTURE
+			delay = l.ActualDepartureDTTM.Sub(l.PlannedDepartureDTTM)
+		}
+		if !l.ActualArrivalDTTM.IsZero() {
+			view.LastPort = l.ToPort
+			view.LastEvent = PC_ARRIVAL
+			delay = l.ActualArrivalDTTM.Sub(l.PlannedArrivalDTTM)
+		}
+	}
+
+	last := v.Route[len(v.Route)-1]
+
+	view.PlannedDTTM = last.PlannedArrivalDTTM
+	view.Arrived = !last.ActualArrivalDTTM.IsZero()
+	view.DelayMins = int64(delay / time.Minute)
+
+	if view.Arrived {
+		view.ETADTTM = last.ActualArrivalDTTM
+	} else {
+		view.ETADTTM = last.PlannedArrivalDTTM.Add(delay)
+	}
+
+	return view
+}
+
+func is_enrolled_as(v Trade, participantId string, relationshipType string) bool {
+	for _, tp := range current_participants(v) {
+		if tp.ParticipantID == participantId && tp.RelationshipType == relationshipType {
+			return true
+		}
+	}
+	return false
+}
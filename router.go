@@ -0,0 +1,568 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//Argument encodings
+const AE_PLAIN = "PLAIN"             // Passed as is
+const AE_JSON = "JSON"               // JSON text passed as is
+const AE_BASE64_JSON = "BASE64_JSON" // JSON text, base64 encoded
+
+//Access
+const AC_READ = "READ"   // Can be queried or invoked
+const AC_WRITE = "WRITE" // Changes the ledger and must be invoked
+
+//Roles that depend on the arguments rather than the caller's type
+const RL_SELF = "SELF" // The participant named by the participantId argument
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	Handler - One chaincode function: its arguments, whether it writes to the ledger and who may call it. Roles are
+//			  participant types, trade relationship types (TR_*) or RL_SELF, any one of which suffices. When they are
+//			  all participant types dispatch checks the caller; otherwise the roles depend on the trade or participant
+//			  named and the function checks them. An empty Roles leaves the caller checks to the function itself.
+//			  Errors are the codes the function and its helpers return; describe adds those raised by Invoke and
+//			  dispatch, and INTERNAL, which any function can return.
+//			  Call receives the arguments decoded, one per declared argument, with optional arguments not given set
+//			  to "".
+//			  Response and each argument's Schema are sample values or a *JSONSchema, read by describe. A nil Response
+//			  means the function returns nothing.
+//==============================================================================================================================
+type Handler struct {
+	Name     string
+	Access   string
+	Roles    []string
+	Errors   []string
+	Args     []HandlerArg
+	Response interface{}
+	Call     func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error)
+}
+
+type HandlerArg struct {
+	Name     string
+	Encoding string
+	Optional bool
+	Schema   interface{}
+}
+
+//	handlerRegistry - Every function that can be invoked or queried. Filled in init as the describe handler reads it.
+var handlerRegistry []Handler
+
+func arg_plain(name string) HandlerArg {
+	return HandlerArg{Name: name, Encoding: AE_PLAIN}
+}
+
+func arg_optional(name string) HandlerArg {
+	return HandlerArg{Name: name, Encoding: AE_PLAIN, Optional: true}
+}
+
+func arg_payload(name string, schema interface{}) HandlerArg {
+	return HandlerArg{Name: name, Encoding: AE_BASE64_JSON, Schema: schema}
+}
+
+func arg_filter(name string, schema interface{}) HandlerArg {
+	return HandlerArg{Name: name, Encoding: AE_JSON, Optional: true, Schema: schema}
+}
+
+func init() {
+	authority := []string{PT_AUTHORITY}
+	port := []string{PT_PORT}
+
+	handlerRegistry = []Handler{
+
+		//Trades
+		{Name: "create_trade", Access: AC_WRITE, Args: []HandlerArg{arg_payload("trade", Trade_List{})}, Response: ScreeningRecord{},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_CONFLICT, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.create_trade(stub, caller, caller_affiliation, []byte(args[0]))
+			}},
+		{Name: "create_trade_from_template", Access: AC_WRITE, Args: []HandlerArg{arg_payload("request", TradeFromTemplate{})}, Response: ScreeningRecord{},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_CONFLICT, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.create_trade_from_template(stub, caller, caller_affiliation, []byte(args[0]))
+			}},
+		{Name: "add_trade_state", Access: AC_WRITE, Args: []HandlerArg{arg_plain("tradeId"), arg_plain("state")},
+			Errors: []string{EC_VALIDATION, EC_NOT_FOUND, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.add_trade_state(stub, caller, caller_affiliation, args[0], args[1])
+			}},
+		{Name: "set_trade_goods", Access: AC_WRITE, Args: []HandlerArg{arg_payload("goods", []GoodsLine{}), arg_plain("tradeId")},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.set_trade_goods(stub, caller, caller_affiliation, []byte(args[0]), args[1])
+			}},
+		{Name: "set_trade_incoterm", Access: AC_WRITE, Roles: []string{SELLER, BUYER}, Args: []HandlerArg{arg_plain("tradeId"), arg_plain("code"), arg_plain("namedPlace")},
+			Errors: []string{EC_VALIDATION, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.set_trade_incoterm(stub, caller, caller_affiliation, args[0], args[1], args[2])
+			}},
+		{Name: "place_hold", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_plain("tradeId"), arg_plain("reason")}, Response: "",
+			Errors: []string{EC_VALIDATION, EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.place_hold(stub, caller, caller_affiliation, args[0], args[1])
+			}},
+		{Name: "lift_hold", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_plain("tradeId"), arg_plain("holdId"), arg_plain("reason")},
+			Errors: []string{EC_VALIDATION, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.lift_hold(stub, caller, caller_affiliation, args[0], args[1], args[2])
+			}},
+		{Name: "get_trades", Access: AC_READ, Response: []Trade{},
+			Errors: []string{EC_NOT_FOUND},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_trades(stub, caller, caller_affiliation)
+			}},
+		{Name: "get_trade", Access: AC_READ, Args: []HandlerArg{arg_plain("tradeId")}, Response: Trade{},
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_trade(stub, caller, caller_affiliation, args[0])
+			}},
+		{Name: "get_goods_summary", Access: AC_READ, Args: []HandlerArg{arg_plain("tradeId")}, Response: GoodsSummary{},
+			Errors: []string{EC_VALIDATION, EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_goods_summary(stub, caller, caller_affiliation, args[0])
+			}},
+		{Name: "get_trade_responsibilities", Access: AC_READ, Args: []HandlerArg{arg_plain("tradeId")}, Response: TradeResponsibilities{},
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_trade_responsibilities(stub, caller, caller_affiliation, args[0])
+			}},
+		{Name: "verify_trade_integrity", Access: AC_READ, Args: []HandlerArg{arg_plain("tradeId")}, Response: IntegrityReport{},
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.verify_trade_integrity(stub, caller, caller_affiliation, args[0])
+			}},
+
+		//Trade participants
+		{Name: "add_participant_to_trade", Access: AC_WRITE, Args: []HandlerArg{arg_payload("tradeParticipant", TradeParticipant{}), arg_plain("tradeId")}, Response: ScreeningRecord{},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_CONFLICT, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.add_participant_to_trade(stub, caller, caller_affiliation, []byte(args[0]), args[1])
+			}},
+		{Name: "accept_trade_invitation", Access: AC_WRITE, Args: []HandlerArg{arg_plain("tradeId"), arg_plain("participantId"), arg_plain("relationshipType")},
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.accept_trade_invitation(stub, caller, caller_affiliation, args[0], args[1], args[2])
+			}},
+		{Name: "decline_trade_invitation", Access: AC_WRITE, Args: []HandlerArg{arg_plain("tradeId"), arg_plain("participantId"), arg_plain("relationshipType"), arg_plain("reason")},
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.decline_trade_invitation(stub, caller, caller_affiliation, args[0], args[1], args[2], args[3])
+			}},
+		{Name: "expire_trade_invitations", Access: AC_WRITE, Args: []HandlerArg{arg_plain("tradeId")},
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.expire_trade_invitations(stub, caller, caller_affiliation, args[0])
+			}},
+		{Name: "remove_participant_from_trade", Access: AC_WRITE, Args: []HandlerArg{arg_plain("tradeId"), arg_plain("participantId"), arg_plain("relationshipType"), arg_plain("reason")},
+			Errors: []string{EC_VALIDATION, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.remove_participant_from_trade(stub, caller, caller_affiliation, args[0], args[1], args[2], args[3])
+			}},
+		{Name: "replace_participant_on_trade", Access: AC_WRITE,
+			Args: []HandlerArg{arg_plain("tradeId"), arg_plain("participantId"), arg_plain("relationshipType"), arg_plain("replacementId"), arg_plain("reason")}, Response: ScreeningRecord{},
+			Errors: []string{EC_VALIDATION, EC_NOT_FOUND, EC_CONFLICT, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.replace_participant_on_trade(stub, caller, caller_affiliation, args[0], args[1], args[2], args[3], args[4])
+			}},
+
+		//Documents
+		{Name: "create_document", Access: AC_WRITE, Args: []HandlerArg{arg_payload("document", schema_one_of(SummaryInvoice{}, SupportingDocument{})), arg_plain("docType")},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_CONFLICT},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.create_document(stub, caller, caller_affiliation, []byte(args[0]), args[1])
+			}},
+		{Name: "add_doc_to_trade", Access: AC_WRITE, Args: []HandlerArg{arg_payload("tradeDoc", TradeDoc{}), arg_plain("tradeId")},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.add_doc_to_trade(stub, caller, caller_affiliation, []byte(args[0]), args[1])
+			}},
+		{Name: "verify_trade_document", Access: AC_WRITE, Roles: []string{PT_CUSTOMS, PT_AUTHORITY}, Args: []HandlerArg{arg_plain("tradeId"), arg_plain("docId")},
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.verify_trade_document(stub, caller, caller_affiliation, args[0], args[1])
+			}},
+		{Name: "add_document_rule", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_payload("rule", DocumentRule{})},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_CONFLICT, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.add_document_rule(stub, caller, caller_affiliation, []byte(args[0]))
+			}},
+		{Name: "remove_document_rule", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_plain("ruleId")},
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.remove_document_rule(stub, caller, caller_affiliation, args[0])
+			}},
+		{Name: "get_documents", Access: AC_READ, Response: schema_array(schema_one_of(SummaryInvoice{}, SupportingDocument{})),
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_documents(stub, caller, caller_affiliation)
+			}},
+		{Name: "get_trade_checklist", Access: AC_READ, Args: []HandlerArg{arg_plain("tradeId")}, Response: TradeChecklist{},
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_trade_checklist(stub, caller, caller_affiliation, args[0])
+			}},
+		{Name: "get_document_rules", Access: AC_READ, Response: DocumentRule_Holder{},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_document_rules(stub, caller, caller_affiliation)
+			}},
+
+		//Participants
+		{Name: "create_participant", Access: AC_WRITE, Args: []HandlerArg{arg_payload("participant", schema_one_of(Participant{}, Authority{})), arg_plain("partyType")}, Response: ScreeningRecord{},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_CONFLICT, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.create_participant(stub, caller, caller_affiliation, []byte(args[0]), args[1])
+			}},
+		{Name: "update_participant", Access: AC_WRITE, Roles: []string{RL_SELF, PT_AUTHORITY}, Args: []HandlerArg{arg_payload("changes", map[string]interface{}{}), arg_plain("participantId"), arg_plain("reason")}, Response: ScreeningRecord{},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.update_participant(stub, caller, caller_affiliation, []byte(args[0]), args[1], args[2])
+			}},
+		{Name: "suspend_participant", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_plain("participantId"), arg_plain("reason")},
+			Errors: []string{EC_VALIDATION, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.suspend_participant(stub, caller, caller_affiliation, args[0], args[1])
+			}},
+		{Name: "reactivate_participant", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_plain("participantId"), arg_plain("reason")},
+			Errors: []string{EC_VALIDATION, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.reactivate_participant(stub, caller, caller_affiliation, args[0], args[1])
+			}},
+		{Name: "deactivate_participant", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_plain("participantId"), arg_plain("reason")},
+			Errors: []string{EC_VALIDATION, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.deactivate_participant(stub, caller, caller_affiliation, args[0], args[1])
+			}},
+		{Name: "submit_kyc", Access: AC_WRITE, Args: []HandlerArg{arg_payload("kyc", KYCProfile{}), arg_plain("participantId")},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.submit_kyc(stub, caller, caller_affiliation, []byte(args[0]), args[1])
+			}},
+		{Name: "verify_kyc", Access: AC_WRITE, Roles: []string{PT_AUTHORITY, PT_BANK},
+			Args:   []HandlerArg{arg_plain("participantId"), arg_plain("status"), arg_plain("expiry"), arg_plain("note")},
+			Errors: []string{EC_VALIDATION, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.verify_kyc(stub, caller, caller_affiliation, args[0], args[1], args[2], args[3])
+			}},
+		{Name: "rebuild_participant_trade_index", Access: AC_WRITE, Roles: authority,
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.rebuild_participant_trade_index(stub, caller, caller_affiliation)
+			}},
+		{Name: "get_participants", Access: AC_READ, Args: []HandlerArg{arg_filter("filter", ParticipantFilter{})}, Response: schema_one_of(schema_array(schema_one_of(Participant{}, Authority{})), ParticipantPage{}),
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				if args[0] != "" {
+					return t.search_participants(stub, caller, caller_affiliation, args[0])
+				}
+				return t.get_participants(stub, caller, caller_affiliation)
+			}},
+		{Name: "get_participant_history", Access: AC_READ, Args: []HandlerArg{arg_plain("participantId")}, Response: ParticipantHistory{},
+			Errors: []string{EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_participant_history(stub, caller, caller_affiliation, args[0])
+			}},
+		{Name: "get_trades_for_participant", Access: AC_READ, Args: []HandlerArg{arg_plain("participantId")}, Response: ParticipantTrades{},
+			Errors: []string{EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_trades_for_participant(stub, caller, caller_affiliation, args[0])
+			}},
+
+		//Logistics
+		{Name: "set_trade_route", Access: AC_WRITE, Args: []HandlerArg{arg_payload("route", []RouteLeg{}), arg_plain("tradeId")},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.set_trade_route(stub, caller, caller_affiliation, []byte(args[0]), args[1])
+			}},
+		{Name: "record_port_call", Access: AC_WRITE, Roles: port, Args: []HandlerArg{arg_plain("tradeId"), arg_plain("portId"), arg_plain("eventType"), arg_plain("eventDTTM")},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.record_port_call(stub, caller, caller_affiliation, args[0], args[1], args[2], args[3])
+			}},
+		{Name: "set_trade_containers", Access: AC_WRITE, Args: []HandlerArg{arg_payload("containers", []Container{}), arg_plain("tradeId")},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_CONFLICT, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.set_trade_containers(stub, caller, caller_affiliation, []byte(args[0]), args[1])
+			}},
+		{Name: "record_port_event", Access: AC_WRITE, Roles: port, Args: []HandlerArg{arg_payload("portEvent", PortEvent{}), arg_plain("tradeId")},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.record_port_event(stub, caller, caller_affiliation, []byte(args[0]), args[1])
+			}},
+		{Name: "get_trade_route", Access: AC_READ, Args: []HandlerArg{arg_plain("tradeId")}, Response: RouteView{},
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_trade_route(stub, caller, caller_affiliation, args[0])
+			}},
+		{Name: "get_trade_for_container", Access: AC_READ, Args: []HandlerArg{arg_plain("containerNo")}, Response: ContainerTrade{},
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_trade_for_container(stub, caller, caller_affiliation, args[0])
+			}},
+
+		//Templates
+		{Name: "save_trade_template", Access: AC_WRITE, Args: []HandlerArg{arg_payload("template", TradeTemplate{})},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.save_trade_template(stub, caller, caller_affiliation, []byte(args[0]))
+			}},
+		{Name: "get_trade_templates", Access: AC_READ, Response: []TradeTemplate{},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_trade_templates(stub, caller, caller_affiliation)
+			}},
+
+		//Tariffs and money
+		{Name: "add_tariff_version", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_payload("tariffVersion", TariffVersion{}), arg_plain("country")},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_CONFLICT, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.add_tariff_version(stub, caller, caller_affiliation, []byte(args[0]), args[1])
+			}},
+		{Name: "add_exchange_rate", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_payload("exchangeRate", ExchangeRateRequest{})},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_CONFLICT, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.add_exchange_rate(stub, caller, caller_affiliation, []byte(args[0]))
+			}},
+		{Name: "calculate_duties", Access: AC_WRITE, Roles: []string{PT_CUSTOMS, PT_AUTHORITY}, Args: []HandlerArg{arg_plain("tradeId"), arg_plain("docId"), arg_optional("asOf")}, Response: DutyAssessment{},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.calculate_duties(stub, caller, caller_affiliation, args[0], args[1], args[2])
+			}},
+		{Name: "get_tariff_schedule", Access: AC_READ, Args: []HandlerArg{arg_plain("country")}, Response: TariffSchedule{},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_tariff_schedule(stub, caller, caller_affiliation, args[0])
+			}},
+		{Name: "get_exchange_rates", Access: AC_READ, Args: []HandlerArg{arg_optional("pair")}, Response: []ExchangeRateSeries{},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_exchange_rates(stub, caller, caller_affiliation, args[0])
+			}},
+
+		//Screening
+		{Name: "add_denied_party", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_payload("deniedParty", DeniedParty{})},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.add_denied_party(stub, caller, caller_affiliation, []byte(args[0]))
+			}},
+		{Name: "remove_denied_party", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_plain("entryId")},
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.remove_denied_party(stub, caller, caller_affiliation, args[0])
+			}},
+		{Name: "add_embargo_rule", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_payload("embargoRule", EmbargoRule{})},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_NOT_FOUND, EC_CONFLICT, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.add_embargo_rule(stub, caller, caller_affiliation, []byte(args[0]))
+			}},
+		{Name: "remove_embargo_rule", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_plain("ruleId")},
+			Errors: []string{EC_NOT_FOUND, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.remove_embargo_rule(stub, caller, caller_affiliation, args[0])
+			}},
+		{Name: "resolve_screening", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_plain("screeningId"), arg_plain("resolution"), arg_plain("note")},
+			Errors: []string{EC_VALIDATION, EC_PERMISSION_DENIED, EC_INVALID_STATE},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.resolve_screening(stub, caller, caller_affiliation, args[0], args[1], args[2])
+			}},
+		{Name: "get_denied_parties", Access: AC_READ, Response: []DeniedParty{},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_denied_parties(stub, caller, caller_affiliation)
+			}},
+		{Name: "get_embargo_rules", Access: AC_READ, Response: Embargo_Holder{},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_embargo_rules(stub, caller, caller_affiliation)
+			}},
+		{Name: "get_screenings", Access: AC_READ, Args: []HandlerArg{arg_optional("subjectId")}, Response: []ScreeningRecord{},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_screenings(stub, caller, caller_affiliation, args[0])
+			}},
+
+		//Countries
+		{Name: "save_country_reference", Access: AC_WRITE, Roles: authority, Args: []HandlerArg{arg_payload("country", Country{})},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_CONFLICT, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.save_country_reference(stub, caller, caller_affiliation, []byte(args[0]))
+			}},
+		{Name: "migrate_legacy_countries", Access: AC_WRITE, Roles: authority,
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.migrate_legacy_countries(stub, caller, caller_affiliation)
+			}},
+		{Name: "get_countries", Access: AC_READ, Response: []Country{},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_countries(stub, caller, caller_affiliation)
+			}},
+		{Name: "get_country", Access: AC_READ, Args: []HandlerArg{arg_plain("code")}, Response: Country{},
+			Errors: []string{EC_NOT_FOUND},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_country(stub, caller, caller_affiliation, args[0])
+			}},
+
+		//Oversight
+		{Name: "get_audit_log", Access: AC_READ, Roles: authority, Args: []HandlerArg{arg_filter("filter", AuditFilter{})}, Response: AuditPage{},
+			Errors: []string{EC_VALIDATION, EC_INVALID_ARGUMENT, EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_audit_log(stub, caller, caller_affiliation, args[0])
+			}},
+		{Name: "get_oversight_log", Access: AC_READ, Roles: authority, Args: []HandlerArg{arg_optional("entityId")}, Response: []OversightEntry{},
+			Errors: []string{EC_PERMISSION_DENIED},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.get_oversight_log(stub, caller, caller_affiliation, args[0])
+			}},
+
+		//Peer, ping is kept for existing clients as an alias of health
+		{Name: "ping", Access: AC_READ, Response: HealthReport{},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.health(stub, caller, caller_affiliation)
+			}},
+		{Name: "health", Access: AC_READ, Response: HealthReport{},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.health(stub, caller, caller_affiliation)
+			}},
+		{Name: "describe", Access: AC_READ, Response: Description{},
+			Call: func(t *SimpleChaincode, stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, args []string) ([]byte, error) {
+				return t.describe(stub, caller, caller_affiliation)
+			}},
+	}
+}
+
+//==============================================================================================================================
+//	 Dispatch
+//==============================================================================================================================
+//	 dispatch - Looks the function up, checks and decodes its arguments and the caller's type, then calls it.
+//				Queries may only reach READ handlers.
+func (t *SimpleChaincode) dispatch(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string,
+	function string, args []string, query bool) ([]byte, error) {
+
+	h, found := find_handler(function)
+
+	if !found {
+		return nil, new_error(EC_UNKNOWN_FUNCTION, "Received unknown function "+function, nil)
+	}
+
+	if query && h.Access != AC_READ {
+		return nil, invalid_argument(function+" changes the ledger and must be invoked rather than queried", nil)
+	}
+
+	decoded, err := h.decode_args(args)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(h.Roles) > 0 && h.caller_type_roles() {
+		err = t.check_caller_roles(stub, caller, h.Roles)
+
+		if err != nil {
+			return nil, wrap_error(err, function)
+		}
+	}
+
+	return h.Call(t, stub, caller, caller_affiliation, decoded)
+}
+
+//	 caller_type_roles - True when every role is a participant type, so the caller can be checked before the call
+func (h Handler) caller_type_roles() bool {
+	for _, role := range h.Roles {
+		if !contains(participantTypes, role) {
+			return false
+		}
+	}
+	return true
+}
+
+func find_handler(function string) (Handler, bool) {
+	for _, h := range handlerRegistry {
+		if h.Name == function {
+			return h, true
+		}
+	}
+	return Handler{}, false
+}
+
+//	 decode_args - One value per declared argument. A function without arguments ignores a single one, which
+//				   clients had to send when every invocation decoded args[0].
+func (h Handler) decode_args(args []string) ([]string, error) {
+
+	required := 0
+
+	for _, a := range h.Args {
+		if !a.Optional {
+			required++
+		}
+	}
+
+	if len(args) < required || (len(args) > len(h.Args) && !(len(h.Args) == 0 && len(args) == 1)) {
+		return nil, invalid_argument(h.Name+": wrong number of arguments ("+strconv.Itoa(len(args))+"). usage: "+h.usage(), nil)
+	}
+
+	decoded := make([]string, len(h.Args))
+
+	for i, a := range h.Args {
+		if i >= len(args) {
+			continue
+		}
+
+		if a.Encoding != AE_BASE64_JSON {
+			decoded[i] = args[i]
+			continue
+		}
+
+		bytes, err := decodeBase64(args[i])
+
+		if err != nil {
+			return nil, invalid_argument(h.Name+": "+a.Name+" is not base64 encoded. usage: "+h.usage(), err)
+		}
+
+		decoded[i] = string(bytes)
+	}
+
+	return decoded, nil
+}
+
+//	 usage - e.g. "calculate_duties <tradeId> <docId> [asOf]"
+func (h Handler) usage() string {
+	parts := []string{h.Name}
+
+	for _, a := range h.Args {
+		name := a.Name
+
+		switch a.Encoding {
+		case AE_BASE64_JSON:
+			name += ":base64 JSON"
+		case AE_JSON:
+			name += ":JSON"
+		}
+
+		if a.Optional {
+			parts = append(parts, "["+name+"]")
+		} else {
+			parts = append(parts, "<"+name+">")
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+//	 check_caller_roles - The caller must be a registered participant of one of the types
+func (t *SimpleChaincode) check_caller_roles(stub shim.ChaincodeStubInterface, caller string, roles []string) error {
+
+	var err error
+
+	for _, role := range roles {
+		err = t.check_caller_type(stub, caller, role)
+
+		if err == nil {
+			return nil
+		}
+	}
+
+	if caller == "" || len(roles) == 1 {
+		return err
+	}
+
+	return permission_denied("Caller " + caller + " must be a participant of type " + strings.Join(roles, " or "))
+}
@@ -0,0 +1,910 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//ScreeningOutcome
+const SO_CLEAR = "CLEAR"
+const SO_REVIEW = "REVIEW"
+const SO_BLOCKED = "BLOCKED"
+
+//ScreeningAction - What a denied-party entry or embargo rule asks for when it is hit
+const SA_BLOCK = "BLOCK"
+const SA_REVIEW = "REVIEW"
+
+//Name similarity at or above which a denied-party entry is a hit, and at or above which a BLOCK entry blocks
+//outright rather than going to review
+const SCREEN_MATCH_THRESHOLD = 0.85
+const SCREEN_BLOCK_THRESHOLD = 0.95
+
+//Ledger keys
+const MK_DENIED_PARTY = "KEY_DENIED_PARTY"
+const MK_EMBARGO = "KEY_EMBARGO"
+const MK_SCREENING = "KEY_SCREENING"
+const DENIED_PARTY_KEY_PREFIX = "DENIED_"
+const SCREENING_KEY_PREFIX = "SCREEN_"
+const SCREENING_STATUS_KEY_PREFIX = "SCREEN_STATUS_"
+
+//Legal-form suffixes ignored when comparing names
+var nameNoiseWords = map[string]bool{
+	"CO": true, "COMPANY": true, "CORP": true, "CORPORATION": true, "INC": true, "LLC": true, "LTD": true,
+	"LIMITED": true, "FZE": true, "FZCO": true, "PLC": true, "PVT": true, "GMBH": true, "SA": true, "THE": true,
+}
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+type DeniedParty struct {
+	EntryId    string    `json:"entryId"`
+	Name       string    `json:"name"`
+	Aliases    []string  `json:"aliases"`
+	Country    string    `json:"country"`
+	Program    string    `json:"program"`
+	Action     string    `json:"action"`
+	ListedDTTM time.Time `json:"listedDTTM"`
+}
+
+//	EmbargoRule - Matches any dealing with Country. If CounterpartyCountry is set the rule only matches trades
+//				  between the two countries, in either direction.
+type EmbargoRule struct {
+	RuleId              string `json:"ruleId"`
+	Country             string `json:"country"`
+	CounterpartyCountry string `json:"counterpartyCountry"`
+	Action              string `json:"action"`
+	Reason              string `json:"reason"`
+}
+
+type ScreeningSubject struct {
+	SubjectId string `json:"subjectId"`
+	Name      string `json:"name"`
+	Country   string `json:"country"`
+}
+
+type ScreeningHit struct {
+	SubjectId   string  `json:"subjectId"`
+	EntryId     string  `json:"entryId"`
+	RuleId      string  `json:"ruleId"`
+	MatchedName string  `json:"matchedName"`
+	Score       float64 `json:"score"`
+	Action      string  `json:"action"`
+	Reason      string  `json:"reason"`
+}
+
+type ScreeningRecord struct {
+	ScreeningId    string             `json:"screeningId"`
+	Operation      string             `json:"operation"`
+	EntityId       string             `json:"entityId"`
+	Subjects       []ScreeningSubject `json:"subjects"`
+	CountryPair    []string           `json:"countryPair"`
+	Hits           []ScreeningHit     `json:"hits"`
+	Outcome        string             `json:"outcome"`
+	ScreenedBy     string             `json:"screenedBy"`
+	ScreenDTTM     time.Time          `json:"screenDTTM"`
+	ResolvedBy     string             `json:"resolvedBy"`
+	ResolvedDTTM   time.Time          `json:"resolvedDTTM"`
+	Resolution     string             `json:"resolution"`
+	ResolutionNote string             `json:"resolutionNote"`
+}
+
+//	ScreeningStatus - Latest screening outcome for a participant or trade
+type ScreeningStatus struct {
+	SubjectId   string `json:"subjectId"`
+	Outcome     string `json:"outcome"`
+	ScreeningId string `json:"screeningId"`
+	Resolved    bool   `json:"resolved"`
+}
+
+//==============================================================================================================================
+//	 Structure Definitions - Global Holders
+//==============================================================================================================================
+type DeniedParty_Holder struct {
+	EntryId []string `json:"entryIdList"`
+}
+
+type Embargo_Holder struct {
+	Rules []EmbargoRule `json:"rules"`
+}
+
+type Screening_Holder struct {
+	ScreeningId []string `json:"screeningIdList"`
+}
+
+//==============================================================================================================================
+//	 Validation
+//==============================================================================================================================
+func (dp DeniedParty) validate() error {
+	v := new_validator()
+
+	v.identifier("entryId", dp.EntryId)
+	v.text("name", dp.Name, MAX_NAME_LENGTH)
+	v.required("action", dp.Action)
+	v.one_of("action", dp.Action, SA_BLOCK, SA_REVIEW)
+
+	for i, alias := range dp.Aliases {
+		v.text(index_field("aliases", i), alias, MAX_NAME_LENGTH)
+	}
+
+	return v.result("DeniedParty")
+}
+
+func (er EmbargoRule) validate() error {
+	v := new_validator()
+
+	v.identifier("ruleId", er.RuleId)
+	v.required("country", er.Country)
+	v.check("counterpartyCountry", er.CounterpartyCountry == "" || er.CounterpartyCountry != er.Country, "must differ from country")
+	v.required("action", er.Action)
+	v.one_of("action", er.Action, SA_BLOCK, SA_REVIEW)
+	v.text("reason", er.Reason, MAX_TEXT_LENGTH)
+
+	return v.result("EmbargoRule")
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Denied Party List and Embargo Rules (authority managed)
+//==============================================================================================================================
+func (t *SimpleChaincode) add_denied_party(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, json_data []byte) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var dp DeniedParty
+
+	err = json.Unmarshal(json_data, &dp)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for add_denied_party", err)
+	}
+
+	err = dp.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if dp.Country != "" {
+		c, err := t.retrieve_country(stub, dp.Country)
+
+		if err != nil {
+			return nil, wrap_error(err, "add_denied_party")
+		}
+
+		dp.Country = c.Alpha2
+	}
+
+	var holder DeniedParty_Holder
+
+	err = t.get_holder(stub, MK_DENIED_PARTY, &holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !contains(holder.EntryId, dp.EntryId) {
+		holder.EntryId = append(holder.EntryId, dp.EntryId)
+	}
+
+	bytes, err := json.Marshal(dp)
+
+	if err != nil {
+		return nil, internal_error("add_denied_party: Error converting denied party record", err)
+	}
+
+	err = stub.PutState(DENIED_PARTY_KEY_PREFIX+dp.EntryId, bytes)
+
+	if err != nil {
+		fmt.Printf("add_denied_party: Error saving changes: %s", err)
+		return nil, internal_error("add_denied_party: Error saving changes", err)
+	}
+
+	err = t.put_holder(stub, MK_DENIED_PARTY, holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, t.record_oversight(stub, caller, "add_denied_party", dp.EntryId, dp.Name)
+}
+
+func (t *SimpleChaincode) remove_denied_party(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, entryId string) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var holder DeniedParty_Holder
+
+	err = t.get_holder(stub, MK_DENIED_PARTY, &holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !contains(holder.EntryId, entryId) {
+		return nil, not_found("remove_denied_party: Unknown denied party entry " + entryId)
+	}
+
+	holder.EntryId = remove(holder.EntryId, entryId)
+
+	err = stub.DelState(DENIED_PARTY_KEY_PREFIX + entryId)
+
+	if err != nil {
+		return nil, internal_error("remove_denied_party: Error removing entry "+entryId, err)
+	}
+
+	err = t.put_holder(stub, MK_DENIED_PARTY, holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, t.record_oversight(stub, caller, "remove_denied_party", entryId, "")
+}
+
+func (t *SimpleChaincode) retrieve_denied_parties(stub shim.ChaincodeStubInterface) ([]DeniedParty, error) {
+
+	var holder DeniedParty_Holder
+
+	err := t.get_holder(stub, MK_DENIED_PARTY, &holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	parties := make([]DeniedParty, 0, len(holder.EntryId))
+
+	for _, entryId := range holder.EntryId {
+		bytes, err := stub.GetState(DENIED_PARTY_KEY_PREFIX + entryId)
+
+		if err != nil || bytes == nil {
+			return nil, wrap_error(err, "Failed to retrieve denied party "+entryId)
+		}
+
+		var dp DeniedParty
+
+		err = json.Unmarshal(bytes, &dp)
+
+		if err != nil {
+			return nil, internal_error("Corrupt denied party record "+entryId, err)
+		}
+
+		parties = append(parties, dp)
+	}
+
+	return parties, nil
+}
+
+// get_denied_parties
+func (t *SimpleChaincode) get_denied_parties(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	parties, err := t.retrieve_denied_parties(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(parties)
+}
+
+func (t *SimpleChaincode) add_embargo_rule(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, json_data []byte) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rule EmbargoRule
+
+	err = json.Unmarshal(json_data, &rule)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for add_embargo_rule", err)
+	}
+
+	err = rule.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range []*string{&rule.Country, &rule.CounterpartyCountry} {
+		if *code == "" {
+			continue
+		}
+
+		c, err := t.retrieve_country(stub, *code)
+
+		if err != nil {
+			return nil, wrap_error(err, "add_embargo_rule")
+		}
+
+		*code = c.Alpha2
+	}
+
+	var holder Embargo_Holder
+
+	err = t.get_holder(stub, MK_EMBARGO, &holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, existing := range holder.Rules {
+		if existing.RuleId == rule.RuleId {
+			return nil, conflict("Embargo rule already exists")
+		}
+	}
+
+	holder.Rules = append(holder.Rules, rule)
+
+	err = t.put_holder(stub, MK_EMBARGO, holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, t.record_oversight(stub, caller, "add_embargo_rule", rule.RuleId, rule.Reason)
+}
+
+func (t *SimpleChaincode) remove_embargo_rule(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, ruleId string) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var holder Embargo_Holder
+
+	err = t.get_holder(stub, MK_EMBARGO, &holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i, existing := range holder.Rules {
+		if existing.RuleId == ruleId {
+			holder.Rules = append(holder.Rules[:i], holder.Rules[i+1:]...)
+
+			err = t.put_holder(stub, MK_EMBARGO, holder)
+
+			if err != nil {
+				return nil, err
+			}
+
+			return nil, t.record_oversight(stub, caller, "remove_embargo_rule", ruleId, "")
+		}
+	}
+
+	return nil, not_found("remove_embargo_rule: Unknown embargo rule " + ruleId)
+}
+
+// get_embargo_rules
+func (t *SimpleChaincode) get_embargo_rules(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	bytes, err := stub.GetState(MK_EMBARGO)
+
+	if err != nil {
+		return nil, internal_error("Unable to get MK_EMBARGO", err)
+	}
+
+	return bytes, nil
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Screening
+//==============================================================================================================================
+//	 screen - Screens the subjects against the denied-party list and, when a country pair is given, the pair against
+//			  the embargo rules. Each subject's own country is checked against blanket embargoes. The record is
+//			  always written to the ledger; the caller decides what to do with the outcome.
+func (t *SimpleChaincode) screen(stub shim.ChaincodeStubInterface, caller string, operation string, entityId string,
+	subjects []ScreeningSubject, countryPair []string) (ScreeningRecord, error) {
+
+	var record ScreeningRecord
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return record, err
+	}
+
+	record.ScreeningId = SCREENING_KEY_PREFIX + stub.GetTxID() + "_" + entityId
+	record.Operation = operation
+	record.EntityId = entityId
+	record.Subjects = subjects
+	record.CountryPair = countryPair
+	record.ScreenedBy = caller
+	record.ScreenDTTM = now
+	record.Hits = []ScreeningHit{}
+
+	parties, err := t.retrieve_denied_parties(stub)
+
+	if err != nil {
+		return record, err
+	}
+
+	var embargoes Embargo_Holder
+
+	err = t.get_holder(stub, MK_EMBARGO, &embargoes)
+
+	if err != nil {
+		return record, err
+	}
+
+	for _, subject := range subjects {
+		record.Hits = append(record.Hits, match_denied_parties(subject, parties)...)
+
+		for _, rule := range embargoes.Rules {
+			if rule.CounterpartyCountry == "" && strings.EqualFold(rule.Country, subject.Country) {
+				record.Hits = append(record.Hits, ScreeningHit{SubjectId: subject.SubjectId, RuleId: rule.RuleId,
+					Score: 1, Action: rule.Action, Reason: rule.Reason})
+			}
+		}
+
+		if c, err := t.retrieve_country(stub, subject.Country); err == nil && c.HighRisk {
+			record.Hits = append(record.Hits, ScreeningHit{SubjectId: subject.SubjectId, Score: 1, Action: SA_REVIEW,
+				Reason: "High-risk country " + c.Alpha2})
+		}
+	}
+
+	if len(countryPair) == 2 {
+		for _, rule := range embargoes.Rules {
+			if rule.CounterpartyCountry != "" && embargo_matches_pair(rule, countryPair[0], countryPair[1]) {
+				record.Hits = append(record.Hits, ScreeningHit{SubjectId: entityId, RuleId: rule.RuleId,
+					Score: 1, Action: rule.Action, Reason: rule.Reason})
+			}
+		}
+	}
+
+	record.Outcome = screening_outcome(record.Hits)
+
+	err = t.save_screening(stub, record, true)
+
+	if err != nil {
+		return record, err
+	}
+
+	for _, subject := range subjects {
+		err = t.set_screening_status(stub, subject.SubjectId, record)
+
+		if err != nil {
+			return record, err
+		}
+	}
+
+	if entityId != "" {
+		err = t.set_screening_status(stub, entityId, record)
+	}
+
+	return record, err
+}
+
+// resolve_screening - Authority decision on a screening that went to review
+func (t *SimpleChaincode) resolve_screening(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string,
+	screeningId string, resolution string, note string) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if resolution != SO_CLEAR && resolution != SO_BLOCKED {
+		return nil, validation_error("resolve_screening: Resolution must be " + SO_CLEAR + " or " + SO_BLOCKED)
+	}
+
+	record, err := t.retrieve_screening(stub, screeningId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if record.Outcome != SO_REVIEW || record.Resolution != "" {
+		return nil, invalid_state("resolve_screening: Screening " + screeningId + " is not awaiting review")
+	}
+
+	record.Resolution = resolution
+	record.ResolutionNote = note
+	record.ResolvedBy = caller
+	record.ResolvedDTTM, err = tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.save_screening(stub, record, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, subject := range record.Subjects {
+		err = t.set_screening_status(stub, subject.SubjectId, record)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if record.EntityId != "" {
+		err = t.set_screening_status(stub, record.EntityId, record)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, t.record_oversight(stub, caller, "resolve_screening", screeningId, resolution+": "+note)
+}
+
+// check_not_blocked - Refuses operations on a participant or trade whose latest screening blocked it or still awaits review
+func (t *SimpleChaincode) check_not_blocked(stub shim.ChaincodeStubInterface, subjectId string) error {
+
+	bytes, err := stub.GetState(SCREENING_STATUS_KEY_PREFIX + subjectId)
+
+	if err != nil {
+		return internal_error("Unable to get screening status for "+subjectId, err)
+	}
+
+	if bytes == nil {
+		return nil
+	}
+
+	var status ScreeningStatus
+
+	err = json.Unmarshal(bytes, &status)
+
+	if err != nil {
+		return internal_error("Corrupt screening status for "+subjectId, err)
+	}
+
+	if status.Outcome == SO_BLOCKED {
+		return invalid_state(subjectId + " is blocked by screening " + status.ScreeningId)
+	}
+
+	if status.Outcome == SO_REVIEW {
+		return invalid_state(subjectId + " is awaiting review of screening " + status.ScreeningId)
+	}
+
+	return nil
+}
+
+// check_trade_screening - Refuses writes to a trade while the trade or any of its current participants is blocked or under review
+func (t *SimpleChaincode) check_trade_screening(stub shim.ChaincodeStubInterface, v Trade) error {
+
+	err := t.check_not_blocked(stub, v.TradeId)
+
+	if err != nil {
+		return err
+	}
+
+	for _, tp := range current_participants(v) {
+		err = t.check_not_blocked(stub, tp.ParticipantID)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// set_screening_status - An authority's resolution stands until the authority resolves again, automatic outcomes never replace it
+
+func (t *SimpleChaincode) set_screening_status(stub shim.ChaincodeStubInterface, subjectId string, record ScreeningRecord) error {
+
+	status := ScreeningStatus{SubjectId: subjectId, Outcome: record.Outcome, ScreeningId: record.ScreeningId}
+
+	if record.Resolution != "" {
+		status.Outcome = record.Resolution
+		status.Resolved = true
+	} else {
+		bytes, err := stub.GetState(SCREENING_STATUS_KEY_PREFIX + subjectId)
+
+		if err != nil {
+			return internal_error("Unable to get screening status for "+subjectId, err)
+		}
+
+		var existing ScreeningStatus
+
+		if bytes != nil && json.Unmarshal(bytes, &existing) == nil && existing.Resolved {
+			return nil
+		}
+	}
+
+	bytes, err := json.Marshal(status)
+
+	if err != nil {
+		return internal_error("Error converting screening status", err)
+	}
+
+	err = stub.PutState(SCREENING_STATUS_KEY_PREFIX+subjectId, bytes)
+
+	if err != nil {
+		return internal_error("Unable to put the screening status for "+subjectId, err)
+	}
+
+	return nil
+}
+
+func (t *SimpleChaincode) save_screening(stub shim.ChaincodeStubInterface, record ScreeningRecord, isNew bool) error {
+
+	bytes, err := json.Marshal(record)
+
+	if err != nil {
+		fmt.Printf("SAVE_SCREENING: Error converting screening record: %s", err)
+		return internal_error("Error converting screening record", err)
+	}
+
+	err = stub.PutState(record.ScreeningId, bytes)
+
+	if err != nil {
+		fmt.Printf("SAVE_SCREENING: Error storing screening record: %s", err)
+		return internal_error("Error storing screening record", err)
+	}
+
+	if !isNew {
+		return nil
+	}
+
+	var holder Screening_Holder
+
+	err = t.get_holder(stub, MK_SCREENING, &holder)
+
+	if err != nil {
+		return err
+	}
+
+	holder.ScreeningId = append(holder.ScreeningId, record.ScreeningId)
+
+	return t.put_holder(stub, MK_SCREENING, holder)
+}
+
+func (t *SimpleChaincode) retrieve_screening(stub shim.ChaincodeStubInterface, screeningId string) (ScreeningRecord, error) {
+
+	var record ScreeningRecord
+
+	bytes, err := stub.GetState(screeningId)
+
+	if err != nil || bytes == nil {
+		return record, wrap_error(err, "Failed to retrieve screening "+screeningId)
+	}
+
+	err = json.Unmarshal(bytes, &record)
+
+	if err != nil {
+		return record, internal_error("Corrupt screening record "+screeningId, err)
+	}
+
+	return record, nil
+}
+
+// get_screenings - All screening records, or only those for the given entity or subject
+func (t *SimpleChaincode) get_screenings(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, subjectId string) ([]byte, error) {
+
+	var holder Screening_Holder
+
+	err := t.get_holder(stub, MK_SCREENING, &holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	records := []ScreeningRecord{}
+
+	for _, screeningId := range holder.ScreeningId {
+		record, err := t.retrieve_screening(stub, screeningId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if subjectId == "" || record.EntityId == subjectId || record.hasSubject(subjectId) {
+			records = append(records, record)
+		}
+	}
+
+	return json.Marshal(records)
+}
+
+// screen_trade_participants - Subjects and origin/destination country pair for the participants of a trade
+func (t *SimpleChaincode) screen_trade_participants(stub shim.ChaincodeStubInterface, participants []TradeParticipant) ([]ScreeningSubject, []string, error) {
+
+	var subjects []ScreeningSubject
+	origin := ""
+	destination := ""
+
+	for _, tp := range participants {
+		party, err := t.retrieve_participant_record(stub, tp.ParticipantID)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		country := t.country_code(stub, party.Country)
+
+		subjects = append(subjects, ScreeningSubject{SubjectId: party.ParticipantID, Name: party.PrimaryName, Country: country})
+
+		switch tp.RelationshipType {
+		case TR_EXPORTER, TR_ORGN_PORT, TR_SRC_CUSTOMS:
+			if origin == "" {
+				origin = country
+			}
+		case TR_IMPORTER, TR_DEST_PORT, TR_DST_CUSTOMS:
+			if destination == "" {
+				destination = country
+			}
+		}
+	}
+
+	if origin == "" || destination == "" {
+		return subjects, nil, nil
+	}
+
+	return subjects, []string{origin, destination}, nil
+}
+
+func (sr ScreeningRecord) hasSubject(subjectId string) bool {
+	for _, s := range sr.Subjects {
+		if s.SubjectId == subjectId {
+			return true
+		}
+	}
+	return false
+}
+
+//==============================================================================================================================
+//	 Global Methods - Matching
+//==============================================================================================================================
+func screening_outcome(hits []ScreeningHit) string {
+	outcome := SO_CLEAR
+
+	for _, hit := range hits {
+		if hit.Action == SA_BLOCK && hit.Score >= SCREEN_BLOCK_THRESHOLD {
+			return SO_BLOCKED
+		}
+		outcome = SO_REVIEW
+	}
+
+	return outcome
+}
+
+func embargo_matches_pair(rule EmbargoRule, origin string, destination string) bool {
+	return (strings.EqualFold(rule.Country, origin) && strings.EqualFold(rule.CounterpartyCountry, destination)) ||
+		(strings.EqualFold(rule.Country, destination) && strings.EqualFold(rule.CounterpartyCountry, origin))
+}
+
+func match_denied_parties(subject ScreeningSubject, parties []DeniedParty) []ScreeningHit {
+	var hits []ScreeningHit
+
+	for _, dp := range parties {
+		best := 0.0
+		bestName := ""
+
+		for _, name := range append([]string{dp.Name}, dp.Aliases...) {
+			score := name_similarity(subject.Name, name)
+
+			if score > best {
+				best = score
+				bestName = name
+			}
+		}
+
+		// A listed country that differs from the subject's is weaker evidence, so it never blocks outright
+		if best >= SCREEN_MATCH_THRESHOLD {
+			action := dp.Action
+			if dp.Country != "" && subject.Country != "" && !strings.EqualFold(dp.Country, subject.Country) {
+				action = SA_REVIEW
+			}
+			hits = append(hits, ScreeningHit{SubjectId: subject.SubjectId, EntryId: dp.EntryId, MatchedName: bestName,
+				Score: best, Action: action, Reason: "Denied party match (" + dp.Program + ")"})
+		}
+	}
+
+	return hits
+}
+
+//	 name_similarity - 1.0 for identical normalised names. Compares both the names as written and with their
+//					   words sorted, so "Trading Acme" still matches "Acme Trading".
+func name_similarity(a string, b string) float64 {
+	ta := name_tokens(a)
+	tb := name_tokens(b)
+
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	score := similarity(strings.Join(ta, " "), strings.Join(tb, " "))
+
+	sort.Strings(ta)
+	sort.Strings(tb)
+
+	sorted := similarity(strings.Join(ta, " "), strings.Join(tb, " "))
+
+	if sorted > score {
+		return sorted
+	}
+	return score
+}
+
+func name_tokens(name string) []string {
+	fields := strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := make([]string, 0, len(fields))
+
+	for _, f := range fields {
+		if !nameNoiseWords[f] {
+			tokens = append(tokens, f)
+		}
+	}
+
+	return tokens
+}
+
+func similarity(a string, b string) float64 {
+	ra := []rune(a)
+	rb := []rune(b)
+
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+
+	if longest == 0 {
+		return 1
+	}
+
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+func levenshtein(a []rune, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min_int(min_int(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+func min_int(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,567 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+// Ledger key prefix for tariff schedules, one record per destination country
+const TARIFF_KEY_PREFIX = "TARIFF_"
+
+// Rates are expressed in basis points (1/100th of a percent)
+const BASIS_POINTS = 10000
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	 TariffSchedule - All tariff versions published for a destination country. Versions are kept sorted by
+//					 effective date and are never overwritten so historical assessments can be reproduced.
+//==============================================================================================================================
+type TariffSchedule struct {
+	Country  string          `json:"country"`
+	Versions []TariffVersion `json:"versions"`
+}
+
+//	 TariffVersion - Duties are assessed in Currency, the currency of the destination customs administration.
+//					 SpecificRate is an amount per SpecificUnit in that currency.
+type TariffVersion struct {
+	EffectiveDTTM time.Time    `json:"effectiveDTTM"`
+	Currency      string       `json:"currency"`
+	VATRate       int64        `json:"vatRate"`
+	Rates         []TariffRate `json:"rates"`
+}
+
+type TariffRate struct {
+	HSCode        string `json:"hsCode"`
+	AdValoremRate int64  `json:"adValoremRate"`
+	SpecificRate  *Money `json:"specificRate,omitempty"`
+	SpecificUnit  string `json:"specificUnit"`
+	VATRate       *int64 `json:"vatRate,omitempty"`
+}
+
+//	 DutyAssessment - Invoice amounts are converted to the tariff currency at the exchange rate effective at AsOfDTTM,
+//					  which is recorded with the assessment.
+type DutyAssessment struct {
+	DocId               string     `json:"docId"`
+	Country             string     `json:"country"`
+	TariffEffectiveDTTM time.Time  `json:"tariffEffectiveDTTM"`
+	AsOfDTTM            time.Time  `json:"asOfDTTM"`
+	AssessDTTM          time.Time  `json:"assessDTTM"`
+	InvoiceCurrency     string     `json:"invoiceCurrency"`
+	Currency            string     `json:"currency"`
+	ExchangeRate        string     `json:"exchangeRate"`
+	Lines               []DutyLine `json:"lines"`
+	TotalValue          Money      `json:"totalValue"`
+	TotalDuty           Money      `json:"totalDuty"`
+	TotalVAT            Money      `json:"totalVAT"`
+	TotalPayable        Money      `json:"totalPayable"`
+}
+
+type DutyLine struct {
+	LineNum       int    `json:"lineNum"`
+	HSCode        string `json:"hsCode"`
+	MatchedHSCode string `json:"matchedHSCode"`
+	InvoiceAmount Money  `json:"invoiceAmount"`
+	CustomsValue  Money  `json:"customsValue"`
+	AdValoremDuty Money  `json:"adValoremDuty"`
+	SpecificDuty  Money  `json:"specificDuty"`
+	VAT           Money  `json:"vat"`
+	Payable       Money  `json:"payable"`
+}
+
+//==============================================================================================================================
+//	 Validation
+//==============================================================================================================================
+func (tv TariffVersion) validate() error {
+	v := new_validator()
+
+	v.required_time("effectiveDTTM", tv.EffectiveDTTM)
+	v.required("currency", tv.Currency)
+	v.format("currency", tv.Currency, zero_money(tv.Currency).validate() == nil, "a supported currency")
+	v.check("vatRate", tv.VATRate >= 0, "must not be negative")
+	v.check("rates", len(tv.Rates) > 0, VR_REQUIRED)
+
+	seen := make(map[string]bool)
+
+	for i, r := range tv.Rates {
+		field := index_field("rates", i)
+
+		v.required(field+".hsCode", r.HSCode)
+		v.check(field+".hsCode", r.HSCode == "" || !seen[r.HSCode], "must be unique, "+r.HSCode+" is repeated")
+		v.check(field+".adValoremRate", r.AdValoremRate >= 0, "must not be negative")
+		v.check(field+".vatRate", r.VATRate == nil || *r.VATRate >= 0, "must not be negative")
+
+		if r.SpecificRate != nil {
+			v.check(field+".specificRate", r.SpecificRate.isPositive() && r.SpecificRate.Currency == tv.Currency,
+				"must be a positive "+tv.Currency+" amount")
+			v.required(field+".specificUnit", r.SpecificUnit)
+		}
+
+		seen[r.HSCode] = true
+	}
+
+	return v.result("TariffVersion")
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Tariff Entity
+//==============================================================================================================================
+//	 add_tariff_version - Publishes a new version of the tariff schedule for a destination country. A version with
+//						  the same effective date as an existing one is rejected; publish a new effective date instead.
+func (t *SimpleChaincode) add_tariff_version(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string,
+	json_data []byte, country string) ([]byte, error) {
+
+	err := t.check_caller_type(stub, caller, PT_AUTHORITY)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := t.retrieve_country(stub, country)
+
+	if err != nil {
+		return nil, wrap_error(err, "add_tariff_version")
+	}
+
+	country = c.Alpha2
+
+	var tv TariffVersion
+
+	err = json.Unmarshal(json_data, &tv)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for add_tariff_version", err)
+	}
+
+	err = tv.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := t.retrieve_tariff_schedule(stub, country)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, existing := range schedule.Versions {
+		if existing.EffectiveDTTM.Equal(tv.EffectiveDTTM) {
+			return nil, conflict("add_tariff_version: A tariff version is already effective from " + tv.EffectiveDTTM.String())
+		}
+	}
+
+	schedule.Country = country
+	schedule.Versions = insert_tariff_version(schedule.Versions, tv)
+
+	_, err = t.save_tariff_schedule(stub, schedule)
+
+	if err != nil {
+		fmt.Printf("add_tariff_version: Error saving changes: %s", err)
+		return nil, internal_error("add_tariff_version: Error saving changes", err)
+	}
+
+	return nil, t.record_oversight(stub, caller, "add_tariff_version", country, "Effective from "+tv.EffectiveDTTM.String())
+}
+
+// retrieve_tariff_schedule - Returns the schedule for the country, or an empty schedule if none has been published
+func (t *SimpleChaincode) retrieve_tariff_schedule(stub shim.ChaincodeStubInterface, country string) (TariffSchedule, error) {
+
+	var schedule TariffSchedule
+
+	bytes, err := stub.GetState(TARIFF_KEY_PREFIX + country)
+
+	if err != nil {
+		fmt.Printf("RETRIEVE_TARIFF: Failed to get tariff schedule: %s", err)
+		return schedule, internal_error("RETRIEVE_TARIFF: Error retrieving tariff schedule for "+country, err)
+	}
+
+	if bytes == nil {
+		schedule.Country = country
+		return schedule, nil
+	}
+
+	err = json.Unmarshal(bytes, &schedule)
+
+	if err != nil {
+		return schedule, internal_error("RETRIEVE_TARIFF: Corrupt tariff schedule for "+country, err)
+	}
+
+	return schedule, nil
+}
+
+func (t *SimpleChaincode) save_tariff_schedule(stub shim.ChaincodeStubInterface, schedule TariffSchedule) (bool, error) {
+
+	bytes, err := json.Marshal(schedule)
+
+	if err != nil {
+		fmt.Printf("SAVE_TARIFF: Error converting tariff schedule: %s", err)
+		return false, internal_error("Error converting tariff schedule", err)
+	}
+
+	err = stub.PutState(TARIFF_KEY_PREFIX+schedule.Country, bytes)
+
+	if err != nil {
+		fmt.Printf("SAVE_TARIFF: Error storing tariff schedule: %s", err)
+		return false, internal_error("Error storing tariff schedule", err)
+	}
+
+	return true, nil
+}
+
+// get_tariff_schedule
+func (t *SimpleChaincode) get_tariff_schedule(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, country string) ([]byte, error) {
+
+	schedule, err := t.retrieve_tariff_schedule(stub, t.country_code(stub, country))
+
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := json.Marshal(schedule)
+
+	if err != nil {
+		return nil, internal_error("GET_TARIFF_SCHEDULE: Invalid tariff schedule object", err)
+	}
+
+	return bytes, nil
+}
+
+//	 calculate_duties - Assesses duty and import VAT for a summary invoice attached to the trade using the tariff
+//						version of the destination country effective at the declaration date (or asOf if given),
+//						and records the assessment on the trade. Only customs enrolled on the trade, or an authority, may assess.
+func (t *SimpleChaincode) calculate_duties(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string,
+	tradeId string, docId string, asOf string) ([]byte, error) {
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "calculate_duties: Failed to retrieve Trade")
+	}
+
+	err = check_not_on_hold(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	isCustoms := is_enrolled_as(v, caller, TR_SRC_CUSTOMS) || is_enrolled_as(v, caller, TR_DST_CUSTOMS)
+
+	if !t.is_authority(stub, caller) && (!isCustoms || check_acting_participant(v, caller) != nil) {
+		return nil, permission_denied("calculate_duties: Only customs on the trade or an authority may assess duties")
+	}
+
+	attached := false
+
+	for _, d := range v.Docs {
+		if d.DocId == docId {
+			attached = true
+			break
+		}
+	}
+
+	if !attached {
+		return nil, not_found("calculate_duties: Document " + docId + " is not attached to trade " + tradeId)
+	}
+
+	invoice, isInvoice, err := t.retrieve_summary_invoice(stub, docId)
+
+	if err != nil {
+		return nil, wrap_error(err, "calculate_duties")
+	}
+
+	if !isInvoice {
+		return nil, validation_error("calculate_duties: Document " + docId + " is not a summary invoice")
+	}
+
+	err = cross_check_invoice(v.Goods, invoice)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(invoice.Lines) == 0 {
+		return nil, validation_error("calculate_duties: Invoice " + docId + " has no lines to assess")
+	}
+
+	country, err := t.get_destination_country(stub, v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	asOfDTTM := declaration_date(v, now)
+
+	if asOf != "" {
+		asOfDTTM, err = time.Parse(time.RFC3339, asOf)
+
+		if err != nil {
+			return nil, invalid_argument("calculate_duties: Invalid asOf date "+asOf, err)
+		}
+	}
+
+	schedule, err := t.retrieve_tariff_schedule(stub, country)
+
+	if err != nil {
+		return nil, err
+	}
+
+	version, found := schedule.versionAt(asOfDTTM)
+
+	if !found {
+		return nil, not_found("calculate_duties: No tariff effective for " + country + " at " + asOfDTTM.String())
+	}
+
+	rate, err := t.exchange_rate(stub, invoice.TotalAmount.Currency, version.Currency, asOfDTTM)
+
+	if err != nil {
+		return nil, wrap_error(err, "calculate_duties")
+	}
+
+	assessment, err := assess_duties(invoice, version, rate)
+
+	if err != nil {
+		return nil, err
+	}
+
+	assessment.Country = country
+	assessment.AsOfDTTM = asOfDTTM
+	assessment.AssessDTTM = now
+
+	v.Assessments = append(v.Assessments, assessment)
+
+	_, err = t.save_trade(stub, v)
+
+	if err != nil {
+		fmt.Printf("calculate_duties: Error saving changes: %s", err)
+		return nil, internal_error("calculate_duties: Error saving changes", err)
+	}
+
+	return json.Marshal(assessment)
+}
+
+//	 get_destination_country - The destination is taken from the destination customs participant, falling back to
+//							   the destination port.
+func (t *SimpleChaincode) get_destination_country(stub shim.ChaincodeStubInterface, v Trade) (string, error) {
+
+	for _, relationship := range []string{TR_DST_CUSTOMS, TR_DEST_PORT} {
+		for _, tp := range active_participants(v) {
+			if tp.RelationshipType != relationship {
+				continue
+			}
+
+			bytes, err := t.retrieve_participant(stub, tp.ParticipantID)
+
+			if err != nil || bytes == nil {
+				return "", wrap_error(err, "Failed to retrieve Participant "+tp.ParticipantID)
+			}
+
+			var party Participant
+
+			err = json.Unmarshal(bytes, &party)
+
+			if err != nil {
+				return "", internal_error("Corrupt Participant record "+tp.ParticipantID, err)
+			}
+
+			return t.country_code(stub, party.Country), nil
+		}
+	}
+
+	return "", validation_error("Trade " + v.TradeId + " has no destination customs or port participant")
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+//	 versionAt - Latest version whose effective date is not after the given date
+func (ts TariffSchedule) versionAt(at time.Time) (TariffVersion, bool) {
+	var result TariffVersion
+	found := false
+
+	for _, tv := range ts.Versions {
+		if tv.EffectiveDTTM.After(at) {
+			break
+		}
+		result = tv
+		found = true
+	}
+
+	return result, found
+}
+
+// rateFor - Longest HS code prefix match, so a 4 or 6 digit heading covers its subheadings
+func (tv TariffVersion) rateFor(hsCode string) (TariffRate, bool) {
+	var result TariffRate
+	found := false
+
+	code := normalise_hs_code(hsCode)
+
+	for _, r := range tv.Rates {
+		prefix := normalise_hs_code(r.HSCode)
+
+		if strings.HasPrefix(code, prefix) && (!found || len(prefix) > len(normalise_hs_code(result.HSCode))) {
+			result = r
+			found = true
+		}
+	}
+
+	return result, found
+}
+
+//	 assess_duties - fxRate converts the invoice currency into the tariff currency
+func assess_duties(invoice SummaryInvoice, tv TariffVersion, fxRate *big.Rat) (DutyAssessment, error) {
+	var a DutyAssessment
+
+	a.DocId = invoice.DocId
+	a.TariffEffectiveDTTM = tv.EffectiveDTTM
+	a.InvoiceCurrency = invoice.TotalAmount.Currency
+	a.Currency = tv.Currency
+	a.ExchangeRate = fxRate.FloatString(10)
+	a.TotalValue = zero_money(tv.Currency)
+	a.TotalDuty = zero_money(tv.Currency)
+	a.TotalVAT = zero_money(tv.Currency)
+
+	for _, line := range invoice.Lines {
+		rate, found := tv.rateFor(line.HSCode)
+
+		if !found {
+			return a, not_found("No tariff rate for HS code " + line.HSCode)
+		}
+
+		if rate.SpecificRate != nil && !strings.EqualFold(rate.SpecificUnit, line.Unit) {
+			return a, validation_error("Invoice line unit " + line.Unit + " does not match tariff unit " + rate.SpecificUnit + " for HS code " + line.HSCode)
+		}
+
+		var dl DutyLine
+		var err error
+
+		dl.LineNum = line.LineNum
+		dl.HSCode = line.HSCode
+		dl.MatchedHSCode = rate.HSCode
+		dl.InvoiceAmount = line.Amount
+
+		dl.CustomsValue, err = convert_at_rate(line.Amount, tv.Currency, fxRate)
+
+		if err != nil {
+			return a, err
+		}
+
+		dl.AdValoremDuty, err = dl.CustomsValue.applyRate(rate.AdValoremRate)
+
+		if err != nil {
+			return a, err
+		}
+
+		dl.SpecificDuty = zero_money(tv.Currency)
+
+		if rate.SpecificRate != nil {
+			dl.SpecificDuty, err = rate.SpecificRate.times(line.Quantity)
+
+			if err != nil {
+				return a, err
+			}
+		}
+
+		vatRate := tv.VATRate
+		if rate.VATRate != nil {
+			vatRate = *rate.VATRate
+		}
+
+		// Import VAT is levied on the customs value plus duty
+		dutiable, err := sum_money(dl.CustomsValue, dl.AdValoremDuty, dl.SpecificDuty)
+
+		if err != nil {
+			return a, err
+		}
+
+		dl.VAT, err = dutiable.applyRate(vatRate)
+
+		if err != nil {
+			return a, err
+		}
+
+		dl.Payable, err = sum_money(dl.AdValoremDuty, dl.SpecificDuty, dl.VAT)
+
+		if err != nil {
+			return a, err
+		}
+
+		a.Lines = append(a.Lines, dl)
+
+		a.TotalValue, err = a.TotalValue.add(dl.CustomsValue)
+
+		if err != nil {
+			return a, err
+		}
+
+		a.TotalDuty, err = sum_money(a.TotalDuty, dl.AdValoremDuty, dl.SpecificDuty)
+
+		if err != nil {
+			return a, err
+		}
+
+		a.TotalVAT, err = a.TotalVAT.add(dl.VAT)
+
+		if err != nil {
+			return a, err
+		}
+	}
+
+	var err error
+
+	a.TotalPayable, err = a.TotalDuty.add(a.TotalVAT)
+
+	return a, err
+}
+
+// insert_tariff_version - Keeps versions ordered by effective date
+func insert_tariff_version(versions []TariffVersion, tv TariffVersion) []TariffVersion {
+	i := len(versions)
+
+	for i > 0 && versions[i-1].EffectiveDTTM.After(tv.EffectiveDTTM) {
+		i--
+	}
+
+	versions = append(versions, TariffVersion{})
+	copy(versions[i+1:], versions[i:])
+	versions[i] = tv
+
+	return versions
+}
+
+// apply_rate - Amount multiplied by a basis point rate, rounded half up
+func apply_rate(amount int64, rate int64) (int64, error) {
+	scaled := new(big.Int).Mul(big.NewInt(amount), big.NewInt(rate))
+	scaled.Add(scaled, big.NewInt(BASIS_POINTS/2))
+
+	return to_minor_units(scaled.Quo(scaled, big.NewInt(BASIS_POINTS)))
+}
+
+func normalise_hs_code(hsCode string) string {
+	return strings.Replace(strings.Replace(hsCode, ".", "", -1), " ", "", -1)
+}
+
+// declaration_date - Time the trade was last declared, or now if it has not been declared yet
+func declaration_date(v Trade, now time.Time) time.Time {
+	for i := len(v.States) - 1; i >= 0; i-- {
+		if v.States[i].State == WS_TRADE_DECLARED {
+			return v.States[i].StateDTTM
+		}
+	}
+	return now
+}
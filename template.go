@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//Ledger keys
+const MK_TEMPLATE = "KEY_TEMPLATE"
+const TEMPLATE_KEY_PREFIX = "TEMPLATE_"
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	TradeTemplate - The fixed parts of a recurring corridor: who takes each relationship, the documents expected on
+//					top of the general rules, the Incoterm and the route. Route legs carry durations rather than
+//					times and are scheduled from the departure given when a trade is created.
+//==============================================================================================================================
+type TradeTemplate struct {
+	TemplateId        string                 `json:"templateId"`
+	Description       string                 `json:"description"`
+	Relationships     []TemplateRelationship `json:"relationships"`
+	RequiredDocuments []DocumentRule         `json:"requiredDocuments"`
+	Incoterm          *Incoterm              `json:"incoterm,omitempty"`
+	Route             []TemplateLeg          `json:"route"`
+	Owner             string                 `json:"owner"`
+	UpdateDTTM        time.Time              `json:"updateDTTM"`
+}
+
+type TemplateRelationship struct {
+	RelationshipType string `json:"relationshipType"`
+	ParticipantID    string `json:"participantId"`
+}
+
+//	TemplateLeg - DwellHours is the time at FromPort before departure, counted from the previous leg's arrival
+type TemplateLeg struct {
+	FromPort      string `json:"fromPort"`
+	ToPort        string `json:"toPort"`
+	TransportMode string `json:"transportMode"`
+	Carrier       string `json:"carrier"`
+	DwellHours    int64  `json:"dwellHours"`
+	TransitHours  int64  `json:"transitHours"`
+}
+
+//	TradeFromTemplate - The per-trade values supplied to create_trade_from_template
+type TradeFromTemplate struct {
+	TemplateId    string      `json:"templateId"`
+	TradeId       string      `json:"tradeId"`
+	Description   string      `json:"description"`
+	ExtRefNum     string      `json:"extRefNum"`
+	DepartureDTTM time.Time   `json:"departureDTTM"`
+	Goods         []GoodsLine `json:"goods"`
+}
+
+type Template_Holder struct {
+	TemplateIds []string `json:"templateIdList"`
+}
+
+//==============================================================================================================================
+//	 Validation
+//==============================================================================================================================
+func (tt TradeTemplate) validate() error {
+	v := new_validator()
+
+	v.identifier("templateId", tt.TemplateId)
+	v.text("description", tt.Description, MAX_TEXT_LENGTH)
+	v.check("relationships", len(tt.Relationships) > 0, VR_REQUIRED)
+
+	for i, r := range tt.Relationships {
+		v.nested(index_field("relationships", i), TradeParticipant{ParticipantID: r.ParticipantID, RelationshipType: r.RelationshipType}.validate())
+	}
+
+	for i, rule := range tt.RequiredDocuments {
+		v.nested(index_field("requiredDocuments", i), rule.validate())
+	}
+
+	if tt.Incoterm != nil {
+		v.nested("incoterm", tt.Incoterm.validate())
+	}
+
+	for i, l := range tt.Route {
+		field := index_field("route", i)
+
+		v.identifier(field+".fromPort", l.FromPort)
+		v.identifier(field+".toPort", l.ToPort)
+		v.one_of(field+".transportMode", l.TransportMode, TM_SEA, TM_AIR, TM_ROAD, TM_RAIL)
+		v.positive(field+".transitHours", l.TransitHours)
+		v.check(field+".dwellHours", l.DwellHours >= 0, "must not be negative")
+	}
+
+	return v.result("TradeTemplate")
+}
+
+func (request TradeFromTemplate) validate() error {
+	v := new_validator()
+
+	v.identifier("templateId", request.TemplateId)
+	v.identifier("tradeId", request.TradeId)
+
+	return v.result("TradeFromTemplate")
+}
+
+//==============================================================================================================================
+//	 Chaincode Methods - Templates
+//==============================================================================================================================
+//	 save_trade_template - Creates or replaces a template. Only its owner or an authority may replace it, and the
+//						   caller must take one of its relationships unless it is an authority.
+func (t *SimpleChaincode) save_trade_template(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, json_data []byte) ([]byte, error) {
+
+	var tt TradeTemplate
+
+	err := json.Unmarshal(json_data, &tt)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for save_trade_template", err)
+	}
+
+	err = tt.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	authority := t.is_authority(stub, caller)
+
+	if !authority && !tt.takes_part(caller) {
+		return nil, permission_denied("save_trade_template: Caller " + caller + " takes no relationship in template " + tt.TemplateId)
+	}
+
+	existing, found, err := t.retrieve_trade_template(stub, tt.TemplateId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if found && !authority && existing.Owner != caller {
+		return nil, permission_denied("save_trade_template: Template " + tt.TemplateId + " belongs to " + existing.Owner)
+	}
+
+	for _, r := range tt.Relationships {
+		err = t.check_participant_active(stub, r.ParticipantID)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range tt.RequiredDocuments {
+		err = t.resolve_rule_countries(stub, &tt.RequiredDocuments[i])
+
+		if err != nil {
+			return nil, wrap_error(err, "save_trade_template")
+		}
+	}
+
+	tt.Owner = caller
+	if found {
+		tt.Owner = existing.Owner
+	}
+
+	tt.UpdateDTTM, err = tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bytes, err := json.Marshal(tt)
+
+	if err != nil {
+		return nil, internal_error("Error converting trade template", err)
+	}
+
+	err = stub.PutState(TEMPLATE_KEY_PREFIX+tt.TemplateId, bytes)
+
+	if err != nil {
+		fmt.Printf("save_trade_template: Error saving changes: %s", err)
+		return nil, internal_error("save_trade_template: Error saving changes", err)
+	}
+
+	if found {
+		return nil, nil
+	}
+
+	var holder Template_Holder
+
+	err = t.get_holder(stub, MK_TEMPLATE, &holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	holder.TemplateIds = append(holder.TemplateIds, tt.TemplateId)
+
+	return nil, t.put_holder(stub, MK_TEMPLATE, holder)
+}
+
+func (t *SimpleChaincode) retrieve_trade_template(stub shim.ChaincodeStubInterface, templateId string) (TradeTemplate, bool, error) {
+
+	var tt TradeTemplate
+
+	bytes, err := stub.GetState(TEMPLATE_KEY_PREFIX + templateId)
+
+	if err != nil {
+		return tt, false, internal_error("Unable to get trade template "+templateId, err)
+	}
+
+	if bytes == nil {
+		return tt, false, nil
+	}
+
+	err = json.Unmarshal(bytes, &tt)
+
+	if err != nil {
+		return tt, false, internal_error("Corrupt trade template "+templateId, err)
+	}
+
+	return tt, true, nil
+}
+
+// get_trade_templates
+func (t *SimpleChaincode) get_trade_templates(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
+
+	var holder Template_Holder
+
+	err := t.get_holder(stub, MK_TEMPLATE, &holder)
+
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []TradeTemplate{}
+
+	for _, id := range holder.TemplateIds {
+		tt, found, err := t.retrieve_trade_template(stub, id)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if found {
+			templates = append(templates, tt)
+		}
+	}
+
+	return json.Marshal(templates)
+}
+
+//	 create_trade_from_template - Builds the trade from the template and the per-trade values and creates it, with
+//								  its enrolments, through create_trade
+func (t *SimpleChaincode) create_trade_from_template(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, json_data []byte) ([]byte, error) {
+
+	var request TradeFromTemplate
+
+	err := json.Unmarshal(json_data, &request)
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for create_trade_from_template", err)
+	}
+
+	err = request.validate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	tt, found, err := t.retrieve_trade_template(stub, request.TemplateId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, not_found("create_trade_from_template: Unknown template " + request.TemplateId)
+	}
+
+	if !t.is_authority(stub, caller) && !tt.takes_part(caller) {
+		return nil, permission_denied("create_trade_from_template: Caller " + caller + " takes no relationship in template " + tt.TemplateId)
+	}
+
+	if len(tt.Route) > 0 && request.DepartureDTTM.IsZero() {
+		return nil, validation_error("create_trade_from_template: A departure date is needed to schedule the template route",
+			FieldError{Field: "departureDTTM", Reason: VR_REQUIRED})
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	trade := Trade{
+		TradeId:      request.TradeId,
+		Description:  request.Description,
+		CreateDTTM:   now,
+		ExtRefNum:    request.ExtRefNum,
+		Goods:        request.Goods,
+		Incoterm:     tt.Incoterm,
+		RequiredDocs: tt.RequiredDocuments,
+		Route:        schedule_template_route(tt.Route, request.DepartureDTTM),
+	}
+
+	for _, r := range tt.Relationships {
+		trade.Participants = append(trade.Participants, TradeParticipant{ParticipantID: r.ParticipantID, RelationshipType: r.RelationshipType})
+	}
+
+	bytes, err := json.Marshal(Trade_List{Trades: []Trade{trade}})
+
+	if err != nil {
+		return nil, internal_error("create_trade_from_template: Error converting trade", err)
+	}
+
+	return t.register_trade(stub, caller, caller_affiliation, bytes, tt.TemplateId)
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+func (tt TradeTemplate) takes_part(participantId string) bool {
+	for _, r := range tt.Relationships {
+		if r.ParticipantID == participantId {
+			return true
+		}
+	}
+	return false
+}
+
+//	 schedule_template_route - Turns template legs into route legs with planned times from the departure
+func schedule_template_route(legs []TemplateLeg, departure time.Time) []RouteLeg {
+	var route []RouteLeg
+
+	at := departure
+
+	for i, l := range legs {
+		if i > 0 {
+			at = at.Add(time.Duration(l.DwellHours) * time.Hour)
+		}
+
+		leg := RouteLeg{LegNum: i + 1, FromPort: l.FromPort, ToPort: l.ToPort, TransportMode: l.TransportMode, Carrier: l.Carrier}
+		leg.PlannedDepartureDTTM = at
+		at = at.Add(time.Duration(l.TransitHours) * time.Hour)
+		leg.PlannedArrivalDTTM = at
+
+		route = append(route, leg)
+	}
+
+	return route
+}
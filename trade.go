@@ -3,7 +3,6 @@ package main
 import (
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	//"github.com/satori/go.uuid"
@@ -21,6 +20,8 @@ const WS_CARGO_ENROUTE = "CRGENR"
 const WS_DOCS_UPLOADED = "DOCSUPL"
 const WS_TRADE_DECLARED = "TRDDECL"
 const WS_TRADE_CLEARED = "TRDCLRD"
+const WS_CARGO_ARRIVED = "CRGARR"
+const WS_CARGO_RELEASED = "CRGRLSD"
 
 //TradeRelationship
 const TR_AUTHORITY = "RGLTR"
@@ -43,6 +44,12 @@ const PT_BANK = "BANK"
 
 //DocumentType
 const DT_SMRY_INVOICE = "SMRYINVC"
+const DT_EXPORT_DECL = "EXPDECL"
+const DT_IMPORT_DECL = "IMPDECL"
+const DT_BILL_OF_LADING = "BOL"
+const DT_INSURANCE_CERT = "INSCERT"
+const DT_PACKING_LIST = "PCKLST"
+const DT_CERT_ORIGIN = "CRTORGN"
 
 //DocumentStatus
 const DS_VERIFIED = true
@@ -74,6 +81,7 @@ type ParticipantInt interface {
 	getType() string
 	getId() string
 	validate() error
+	getParticipant() Participant
 }
 
 //==============================================================================================================================
@@ -93,6 +101,17 @@ type Trade struct {
 	States       []TradeState       `json:"states"`
 	Participants []TradeParticipant `json:"participants"`
 	Docs         []TradeDoc         `json:"docs"`
+	Assessments  []DutyAssessment   `json:"assessments"`
+	Holds        []TradeHold        `json:"holds"`
+	Goods        []GoodsLine        `json:"goods"`
+	Route        []RouteLeg         `json:"route"`
+	PortCalls    []PortCall         `json:"portCalls"`
+	Containers   []Container        `json:"containers"`
+	PortEvents   []PortEvent        `json:"portEvents"`
+	Incoterm     *Incoterm          `json:"incoterm,omitempty"`
+	RequiredDocs []DocumentRule     `json:"requiredDocuments"`
+	TemplateId   string             `json:"templateId"`
+	History      []HistoryEntry     `json:"history"`
 }
 
 type TradeState struct {
@@ -101,16 +120,30 @@ type TradeState struct {
 }
 
 type TradeParticipant struct {
-	ParticipantID    string    `json:"participantId"`
-	RelationshipType string    `json:"relationshipType"`
-	EnrolDTTM        time.Time `json:"enrolDTTM"`
+	ParticipantID     string    `json:"participantId"`
+	RelationshipType  string    `json:"relationshipType"`
+	EnrolDTTM         time.Time `json:"enrolDTTM"`
+	Status            string    `json:"status"`
+	InvitedBy         string    `json:"invitedBy"`
+	InviteDTTM        time.Time `json:"inviteDTTM"`
+	ExpiryDTTM        time.Time `json:"expiryDTTM"`
+	RespondDTTM       time.Time `json:"respondDTTM"`
+	ResponseNote      string    `json:"responseNote"`
+	EffectiveFromDTTM time.Time `json:"effectiveFromDTTM"`
+	EffectiveToDTTM   time.Time `json:"effectiveToDTTM"`
+	EndedBy           string    `json:"endedBy"`
+	EndReason         string    `json:"endReason"`
+	ReplacedBy        string    `json:"replacedBy"`
 }
 
 type TradeDoc struct {
-	DocId       string    `json:"docId"`
-	AddedBy     string    `json:"addedBy"`
-	AddedByType string    `json:"addedByType"`
-	AddedDTTM   time.Time `json:"attachDTTM"`
+	DocId        string    `json:"docId"`
+	AddedBy      string    `json:"addedBy"`
+	AddedByType  string    `json:"addedByType"`
+	AddedDTTM    time.Time `json:"attachDTTM"`
+	Verified     bool      `json:"verified"`
+	VerifiedBy   string    `json:"verifiedBy"`
+	VerifiedDTTM time.Time `json:"verifiedDTTM"`
 }
 
 type Trade_List struct {
@@ -129,15 +162,33 @@ type Document struct {
 
 type SummaryInvoice struct {
 	Document    `json:"document"`
-	TotalAmount int64 `json:"totalAmount"`
+	TotalAmount Money         `json:"totalAmount"`
+	Lines       []InvoiceLine `json:"lines"`
+}
+
+type SupportingDocument struct {
+	Document `json:"document"`
+}
+
+type InvoiceLine struct {
+	LineNum     int    `json:"lineNum"`
+	HSCode      string `json:"hsCode"`
+	Description string `json:"description"`
+	Quantity    int64  `json:"quantity"`
+	Unit        string `json:"unit"`
+	Amount      Money  `json:"amount"`
 }
 
 type Participant struct {
-	ParticipantID string `json:"participantId"`
-	PrimaryName   string `json:"primaryName"`
-	Address       string `json:"address"`
-	Country       string `json:"country"`
-	Type          string `json:"type"`
+	ParticipantID string      `json:"participantId"`
+	PrimaryName   string      `json:"primaryName"`
+	Address       string      `json:"address"`
+	Country       string      `json:"country"`
+	Type          string      `json:"type"`
+	Status        string      `json:"status"`
+	StatusReason  string      `json:"statusReason"`
+	StatusDTTM    time.Time   `json:"statusDTTM"`
+	KYC           *KYCProfile `json:"kyc,omitempty"`
 }
 
 type Trader struct {
@@ -160,7 +211,7 @@ type InvoiceValidationData struct {
 	tradeId string `json: "tradeId"`
 	docId   string `json: "docId"`
 	docType string `json: "docType"`
-	amount  int64  `json: "amount"`
+	amount  Money  `json: "amount"`
 }
 
 //==============================================================================================================================
@@ -213,6 +264,10 @@ func (p Customs) getId() string {
 	return p.ParticipantID
 }
 
+func (p Participant) getParticipant() Participant {
+	return p
+}
+
 func (sd SummaryInvoice) getType() string {
 	return sd.Type
 }
@@ -225,6 +280,18 @@ func (sd SummaryInvoice) getDocument() Document {
 	return sd.Document
 }
 
+func (sd SupportingDocument) getType() string {
+	return sd.Type
+}
+
+func (sd SupportingDocument) getId() string {
+	return sd.DocId
+}
+
+func (sd SupportingDocument) getDocument() Document {
+	return sd.Document
+}
+
 func (sd Document) getType() string {
 	return sd.Type
 }
@@ -250,55 +317,233 @@ func (party Port) validate() error {
 }
 
 func (party Participant) validate() error {
-	if party.ParticipantID == "" || party.PrimaryName == "" || party.Address == "" || party.Country == "" {
+	v := new_validator()
 
-		fmt.Printf("Validate: Null value provided for Participant attribute(s)")
-		return errors.New("Validate: Null value provided for Participant attribute(s)")
-	} else {
-		return nil
+	v.identifier("participantId", party.ParticipantID)
+	v.text("primaryName", party.PrimaryName, MAX_NAME_LENGTH)
+	v.text("address", party.Address, MAX_TEXT_LENGTH)
+	v.text("country", party.Country, MAX_ID_LENGTH)
+	v.one_of("type", party.Type, participantTypes...)
+
+	if party.KYC != nil {
+		v.nested("kyc", party.KYC.validate())
+	}
+
+	return v.result("Participant")
+}
+
+func (d Document) validate() error {
+	v := new_validator()
+
+	v.identifier("docId", d.DocId)
+	v.text("description", d.Description, MAX_TEXT_LENGTH)
+	v.identifier("createdBy", d.CreatedBy)
+	v.required("createdByType", d.CreatedByType)
+	v.one_of("createdByType", d.CreatedByType, participantTypes...)
+	v.required_time("createDTTM", d.CreateDTTM)
+	v.text("extRefNum", d.ExtRefNum, MAX_ID_LENGTH)
+
+	return v.result("Document")
+}
+
+//	 validate - The payload rules of a new trade. Goods countries, enrolments and the route are checked against
+//				the ledger by create_trade once these pass.
+func (trade Trade) validate() error {
+	v := new_validator()
+
+	v.identifier("tradeId", trade.TradeId)
+	v.text("description", trade.Description, MAX_TEXT_LENGTH)
+	v.required_time("createDTTM", trade.CreateDTTM)
+	v.text("extRefNum", trade.ExtRefNum, MAX_ID_LENGTH)
+
+	validate_goods_lines(v, trade.Goods)
+
+	for i, tp := range trade.Participants {
+		v.nested(index_field("participants", i), tp.validate())
 	}
+
+	if trade.Incoterm != nil {
+		v.nested("incoterm", trade.Incoterm.validate())
+	}
+
+	for i, rule := range trade.RequiredDocs {
+		v.nested(index_field("requiredDocuments", i), rule.validate())
+	}
+
+	return v.result("Trade")
+}
+
+func (tp TradeParticipant) validate() error {
+	v := new_validator()
+
+	v.identifier("participantId", tp.ParticipantID)
+	v.required("relationshipType", tp.RelationshipType)
+	v.one_of("relationshipType", tp.RelationshipType, relationshipTypes...)
+
+	return v.result("TradeParticipant")
+}
+
+func (tDoc TradeDoc) validate() error {
+	v := new_validator()
+
+	v.identifier("docId", tDoc.DocId)
+	v.identifier("addedBy", tDoc.AddedBy)
+	v.one_of("addedByType", tDoc.AddedByType, participantTypes...)
+
+	return v.result("TradeDoc")
 }
 
 //==============================================================================================================================
 //	 Chaincode Methods - Trade Entity
 //==============================================================================================================================
+//	 create_trade - Trades created directly are never linked to a template, whatever templateId the payload carries
 func (t *SimpleChaincode) create_trade(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, trade_json []byte) ([]byte, error) {
+	return t.register_trade(stub, caller, caller_affiliation, trade_json, "")
+}
+
+//	 register_trade - Creates the trade in trade_json. Only create_trade_from_template passes a templateId.
+func (t *SimpleChaincode) register_trade(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, trade_json []byte, templateId string) ([]byte, error) {
 
 	var trades Trade_List
 
 	err := json.Unmarshal(trade_json, &trades) // Convert the JSON defined above into a vehicle object for go
 
 	if err != nil {
-		return nil, errors.New("Invalid JSON object provided for create_trade")
+		return nil, invalid_argument("Invalid JSON object provided for create_trade", err)
+	}
+
+	if len(trades.Trades) == 0 {
+		return nil, validation_error("create_trade: No trade provided", FieldError{Field: "trades", Reason: VR_REQUIRED})
 	}
 
+	trades.Trades[0].TemplateId = templateId
+
 	logger.Debug(trades.Trades[0].TradeId + trades.Trades[0].Description + trades.Trades[0].CreateDTTM.String() + trades.Trades[0].ExtRefNum)
 
-	if trades.Trades[0].TradeId == "" || trades.Trades[0].Description == "" || trades.Trades[0].CreateDTTM.String() == "" || trades.Trades[0].ExtRefNum == "" {
+	err = trades.Trades[0].validate()
+
+	if err != nil {
+		fmt.Printf("CREATE_TRADE: %s", err)
+		return nil, err
+	}
+
+	err = t.check_goods_countries(stub, trades.Trades[0].Goods)
 
-		fmt.Printf("CREATE_TRADE: Null value provided for Trade attribute(s)")
-		return nil, errors.New("Null value provided for Trade attribute(s)")
+	if err != nil {
+		return nil, err
+	}
+
+	err = check_incoterm(trades.Trades[0])
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range trades.Trades[0].RequiredDocs {
+		err = t.resolve_rule_countries(stub, &trades.Trades[0].RequiredDocs[i])
+
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	record, err := stub.GetState(trades.Trades[0].TradeId) // If not an error then a record exists so cant create a new trade with this tradeId as it must be unique
 
 	if record != nil {
-		return nil, errors.New("Trade already exists")
+		return nil, conflict("Trade already exists")
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range trades.Trades[0].Participants {
+		tp := new_invitation(trades.Trades[0].Participants[i], caller, now)
+
+		err = t.check_not_blocked(stub, tp.ParticipantID)
+
+		if err != nil {
+			return nil, err
+		}
+
+		//The creator's own enrolments need no consent, everyone else is invited and has to accept
+		if tp.ParticipantID == caller {
+			err = t.check_acceptance(stub, tp.ParticipantID, tp.RelationshipType)
+
+			if err != nil {
+				return nil, err
+			}
+
+			tp = accept_invitation(tp, now)
+		}
+
+		trades.Trades[0].Participants[i] = tp
+	}
+
+	//Documents and states are only added through add_doc_to_trade and add_trade_state, which run the checklist.
+	//Assessments, holds, port activity and containers likewise only come from their own invokes.
+	trades.Trades[0].History = nil
+	trades.Trades[0].Docs = nil
+	trades.Trades[0].States = nil
+	trades.Trades[0].Assessments = nil
+	trades.Trades[0].Holds = nil
+	trades.Trades[0].PortCalls = nil
+	trades.Trades[0].PortEvents = nil
+	trades.Trades[0].Containers = nil
+
+	for i := range trades.Trades[0].Route {
+		trades.Trades[0].Route[i].ActualDepartureDTTM = time.Time{}
+		trades.Trades[0].Route[i].ActualArrivalDTTM = time.Time{}
+	}
+
+	if len(trades.Trades[0].Route) > 0 {
+		err = validate_route(trades.Trades[0], trades.Trades[0].Route)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	subjects, countryPair, err := t.screen_trade_participants(stub, trades.Trades[0].Participants)
+
+	if err != nil {
+		return nil, err
+	}
+
+	screening, err := t.screen(stub, caller, "create_trade", trades.Trades[0].TradeId, subjects, countryPair)
+
+	if err != nil {
+		return nil, err
 	}
 
-	add_trade_state(&trades.Trades[0], WS_CARGO_ENROUTE)
+	if screening.Outcome == SO_BLOCKED {
+		logger.Warning("CREATE_TRADE: Trade " + trades.Trades[0].TradeId + " blocked by screening " + screening.ScreeningId)
+		return json.Marshal(screening)
+	}
+
+	add_trade_state(&trades.Trades[0], WS_CARGO_ENROUTE, now)
 
 	_, err = t.save_trade(stub, trades.Trades[0])
 
 	if err != nil {
 		fmt.Printf("CREATE_TRADE: Error saving changes: %s", err)
-		return nil, errors.New("Error saving changes")
+		return nil, internal_error("Error saving changes", err)
+	}
+
+	for _, tp := range trades.Trades[0].Participants {
+		err = t.index_participant_trade(stub, trades.Trades[0].TradeId, tp)
+
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	bytes, err := stub.GetState(MK_TRADE)
 
 	if err != nil {
-		return nil, errors.New("func createTrade(trade_json string) unable to get tradeId")
+		return nil, internal_error("create_trade: Unable to get MK_TRADE", err)
 	}
 
 	var tradeHolder Trade_Holder
@@ -306,7 +551,7 @@ func (t *SimpleChaincode) create_trade(stub shim.ChaincodeStubInterface, caller
 	err = json.Unmarshal(bytes, &tradeHolder)
 
 	if err != nil {
-		return nil, errors.New("Corrupt Trade_Holder record")
+		return nil, internal_error("Corrupt Trade_Holder record", err)
 	}
 
 	tradeHolder.TradeId = append(tradeHolder.TradeId, trades.Trades[0].TradeId)
@@ -320,28 +565,41 @@ func (t *SimpleChaincode) create_trade(stub shim.ChaincodeStubInterface, caller
 	err = stub.PutState(MK_TRADE, bytes)
 
 	if err != nil {
-		return nil, errors.New("Unable to put the state Trade_Holder")
+		return nil, internal_error("Unable to put the state Trade_Holder", err)
 	}
 
-	return nil, nil
+	return nil, t.emit_event(stub, caller, "create_trade", ET_TRADE, trades.Trades[0].TradeId, "", current_state(trades.Trades[0]),
+		map[string]string{"templateId": trades.Trades[0].TemplateId})
 }
 
 // save_trade - Writes to the ledger the Trade struct passed in a JSON format. Uses the shim file's
 //				  method 'PutState'.
 func (t *SimpleChaincode) save_trade(stub shim.ChaincodeStubInterface, trade Trade) (bool, error) {
 
+	err := chain_trade_history(&trade)
+
+	if err != nil {
+		return false, err
+	}
+
+	err = t.anchor_trade_history(stub, trade)
+
+	if err != nil {
+		return false, err
+	}
+
 	bytes, err := json.Marshal(trade)
 
 	if err != nil {
 		fmt.Printf("SAVE_TRADE: Error converting trade record: %s", err)
-		return false, errors.New("Error converting trade record")
+		return false, internal_error("Error converting trade record", err)
 	}
 
 	err = stub.PutState(trade.TradeId, bytes)
 
 	if err != nil {
 		fmt.Printf("SAVE_TRADE: Error storing trade record: %s", err)
-		return false, errors.New("Error storing trade record")
+		return false, internal_error("Error storing trade record", err)
 	}
 
 	return true, nil
@@ -352,7 +610,7 @@ func (t *SimpleChaincode) get_trades(stub shim.ChaincodeStubInterface, caller st
 	bytes, err := stub.GetState(MK_TRADE)
 
 	if err != nil {
-		return nil, errors.New("Unable to get MK_TRADE")
+		return nil, internal_error("Unable to get MK_TRADE", err)
 	}
 
 	var trades Trade_Holder
@@ -360,7 +618,7 @@ func (t *SimpleChaincode) get_trades(stub shim.ChaincodeStubInterface, caller st
 	err = json.Unmarshal(bytes, &trades)
 
 	if err != nil {
-		return nil, errors.New("Corrupt Trade_Holder")
+		return nil, internal_error("Corrupt Trade_Holder", err)
 	}
 
 	result := "["
@@ -373,7 +631,7 @@ func (t *SimpleChaincode) get_trades(stub shim.ChaincodeStubInterface, caller st
 		v, err = t.retrieve_trade(stub, tradeId)
 
 		if err != nil {
-			return nil, errors.New("Failed to retrieve Trade")
+			return nil, wrap_error(err, "Failed to retrieve Trade")
 		}
 
 		temp, err = t.get_trade_details(stub, v, caller, caller_affiliation)
@@ -403,14 +661,18 @@ func (t *SimpleChaincode) retrieve_trade(stub shim.ChaincodeStubInterface, trade
 
 	if err != nil {
 		fmt.Printf("RETRIEVE_TRADE: Failed to invoke tradeId: %s", err)
-		return v, errors.New("RETRIEVE_TRADE: Error retrieving trade with ID = " + tradeId)
+		return v, internal_error("RETRIEVE_TRADE: Error retrieving trade with ID = "+tradeId, err)
+	}
+
+	if bytes == nil {
+		return v, not_found("RETRIEVE_TRADE: Trade " + tradeId + " does not exist")
 	}
 
 	err = json.Unmarshal(bytes, &v)
 
 	if err != nil {
 		fmt.Printf("RETRIEVE_TRADE: Corrupt trade record "+string(bytes)+": %s", err)
-		return v, errors.New("RETRIEVE_TRADE: Corrupt trade record" + string(bytes))
+		return v, internal_error("RETRIEVE_TRADE: Corrupt trade record"+string(bytes), err)
 	}
 
 	return v, nil
@@ -419,32 +681,91 @@ func (t *SimpleChaincode) retrieve_trade(stub shim.ChaincodeStubInterface, trade
 //	 get_trade_details
 func (t *SimpleChaincode) get_trade_details(stub shim.ChaincodeStubInterface, v Trade, caller string, caller_affiliation string) ([]byte, error) {
 
+	if !t.can_read_trade(stub, v, caller) {
+		return nil, permission_denied("GET_TRADE_DETAILS: Caller " + caller + " is not permitted to read trade " + v.TradeId)
+	}
+
 	bytes, err := json.Marshal(v)
 
 	if err != nil {
-		return nil, errors.New("GET_TRADE_DETAILS: Invalid trade object")
+		return nil, internal_error("GET_TRADE_DETAILS: Invalid trade object", err)
 	}
 
 	return bytes, nil
 }
 
+//	 get_trade
+func (t *SimpleChaincode) get_trade(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, tradeId string) ([]byte, error) {
+
+	v, err := t.retrieve_trade(stub, tradeId)
+
+	if err != nil {
+		return nil, wrap_error(err, "Failed to retrieve Trade")
+	}
+
+	return t.get_trade_details(stub, v, caller, caller_affiliation)
+}
+
 //	 add_trade_state
 func (t *SimpleChaincode) add_trade_state(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string, tradeId string, state string) ([]byte, error) {
 
 	v, err := t.retrieve_trade(stub, tradeId)
 
 	if err != nil {
-		return nil, errors.New("add_trade_state: Failed to retrieve Trade")
+		return nil, wrap_error(err, "add_trade_state: Failed to retrieve Trade")
 	} else {
+		err = check_not_on_hold(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = t.check_trade_screening(stub, v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = check_state_transition(v, state)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = t.check_document_checklist(stub, v, state)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if state == WS_TRADE_DECLARED {
+			if len(v.Goods) == 0 {
+				return nil, invalid_state("add_trade_state: Trade " + tradeId + " has no goods lines to declare")
+			}
+
+			err = t.cross_check_trade_invoices(stub, v)
+
+			if err != nil {
+				return nil, err
+			}
+		}
 
-		add_trade_state(&v, state)
+		previous := current_state(v)
+
+		now, err := tx_time(stub)
+
+		if err != nil {
+			return nil, err
+		}
+
+		add_trade_state(&v, state, now)
 		_, err = t.save_trade(stub, v)
 
 		if err != nil {
 			fmt.Printf("add_trade_state: Error saving changes: %s", err)
-			return nil, errors.New("add_trade_state: Error saving changes")
+			return nil, internal_error("add_trade_state: Error saving changes", err)
 		}
-		return nil, nil
+		return nil, t.emit_event(stub, caller, "add_trade_state", ET_TRADE, tradeId, previous, state, nil)
 	}
 }
 
@@ -457,7 +778,7 @@ func (t *SimpleChaincode) create_document(stub shim.ChaincodeStubInterface, call
 	document, err := createDocument(document_json, documentType)
 
 	if err != nil {
-		return nil, errors.New("Invalid JSON object provided for create_trade_document")
+		return nil, wrap_error(err, "Invalid JSON object provided for create_document")
 	}
 
 	err = document.validate()
@@ -469,20 +790,20 @@ func (t *SimpleChaincode) create_document(stub shim.ChaincodeStubInterface, call
 	record, err := stub.GetState(document.getId()) // If not an error then a record exists so cant create a new document with this docId as it must be unique
 
 	if record != nil {
-		return nil, errors.New("Document already exists")
+		return nil, conflict("Document already exists")
 	}
 
 	_, err = t.save_document(stub, document)
 
 	if err != nil {
 		fmt.Printf("CREATE_DOC: Error saving changes: %s", err)
-		return nil, errors.New("CREATE_DOC: Error saving changes")
+		return nil, internal_error("CREATE_DOC: Error saving changes", err)
 	}
 
 	bytes, err := stub.GetState(MK_DOCUMENT)
 
 	if err != nil {
-		return nil, errors.New("func CREATE_DOC(trade_json string) unable to get docId")
+		return nil, internal_error("create_document: Unable to get MK_DOCUMENT", err)
 	}
 
 	var docHolder Document_Holder
@@ -490,7 +811,7 @@ func (t *SimpleChaincode) create_document(stub shim.ChaincodeStubInterface, call
 	err = json.Unmarshal(bytes, &docHolder)
 
 	if err != nil {
-		return nil, errors.New("Corrupt Document_Holder record")
+		return nil, internal_error("Corrupt Document_Holder record", err)
 	}
 
 	docHolder.DocumentId = append(docHolder.DocumentId, document.getId())
@@ -504,10 +825,10 @@ func (t *SimpleChaincode) create_document(stub shim.ChaincodeStubInterface, call
 	err = stub.PutState(MK_DOCUMENT, bytes)
 
 	if err != nil {
-		return nil, errors.New("Unable to put the state Document_Holder")
+		return nil, internal_error("Unable to put the state Document_Holder", err)
 	}
 
-	return nil, nil
+	return nil, t.emit_event(stub, caller, "create_document", ET_DOCUMENT, document.getId(), "", document.getType(), nil)
 }
 
 //==============================================================================================================================
@@ -520,7 +841,7 @@ func (t *SimpleChaincode) retrieve_document(stub shim.ChaincodeStubInterface, do
 
 	if err != nil {
 		fmt.Printf("retrieve_document: Failed to invoke documentId: %s", err)
-		return nil, errors.New("retrieve_document: Error documentId trade with ID = " + documentId)
+		return nil, internal_error("retrieve_document: Error retrieving document with ID = "+documentId, err)
 	}
 
 	return bytes, nil
@@ -534,7 +855,7 @@ func (t *SimpleChaincode) get_documents(stub shim.ChaincodeStubInterface, caller
 	bytes, err := stub.GetState(MK_DOCUMENT)
 
 	if err != nil {
-		return nil, errors.New("Unable to get MK_DOCUMENT")
+		return nil, internal_error("Unable to get MK_DOCUMENT", err)
 	}
 
 	var documents Document_Holder
@@ -542,7 +863,7 @@ func (t *SimpleChaincode) get_documents(stub shim.ChaincodeStubInterface, caller
 	err = json.Unmarshal(bytes, &documents)
 
 	if err != nil {
-		return nil, errors.New("Corrupt Document_Holder")
+		return nil, internal_error("Corrupt Document_Holder", err)
 	}
 
 	result := "["
@@ -554,7 +875,7 @@ func (t *SimpleChaincode) get_documents(stub shim.ChaincodeStubInterface, caller
 		temp, err = t.retrieve_document(stub, documentsId)
 
 		if err != nil {
-			return nil, errors.New("Failed to retrieve Document")
+			return nil, wrap_error(err, "Failed to retrieve Document")
 		}
 
 		//		temp, err = t.get_participant_details(stub, v, caller, caller_affiliation)
@@ -581,14 +902,14 @@ func (t *SimpleChaincode) save_document(stub shim.ChaincodeStubInterface, doc Do
 
 	if err != nil {
 		fmt.Printf("SAVE_DOC: Error converting document record: %s", err)
-		return false, errors.New("SAVE_DOC: Error converting document record")
+		return false, internal_error("SAVE_DOC: Error converting document record", err)
 	}
 
 	err = stub.PutState(doc.getId(), bytes)
 
 	if err != nil {
 		fmt.Printf("SAVE_DOC: Error storing document record: %s", err)
-		return false, errors.New("Error storing document record")
+		return false, internal_error("Error storing document record", err)
 	}
 
 	return true, nil
@@ -598,38 +919,154 @@ func (t *SimpleChaincode) add_doc_to_trade(stub shim.ChaincodeStubInterface, cal
 	v, err := t.retrieve_trade(stub, tradeId)
 
 	if err != nil {
-		return nil, errors.New("add_docToTrade: Failed to retrieve Trade")
+		return nil, wrap_error(err, "add_doc_to_trade: Failed to retrieve Trade")
 	} else {
 		var tDoc TradeDoc
 
 		err = json.Unmarshal(json_data, &tDoc)
 
 		if err != nil {
-			return nil, errors.New("Corrupt TradeDoc JSON received")
+			return nil, invalid_argument("Corrupt TradeDoc JSON received", err)
+		}
+
+		err = check_not_on_hold(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = t.check_trade_screening(stub, v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = tDoc.validate()
+
+		if err != nil {
+			return nil, err
+		}
+
+		tDoc.Verified = DS_UNVERIFIED
+		tDoc.VerifiedBy = ""
+		tDoc.VerifiedDTTM = time.Time{}
+
+		//The document is attributed to the caller, so the checks below and the verification rules apply to them
+		if tDoc.AddedBy != caller {
+			return nil, permission_denied("add_doc_to_trade: Caller " + caller + " may not add a document on behalf of " + tDoc.AddedBy)
+		}
+
+		party, err := t.retrieve_participant_record(stub, caller)
+
+		if err != nil {
+			return nil, wrap_error(err, "add_doc_to_trade: Failed to retrieve Participant")
+		}
+
+		tDoc.AddedByType = party.Type
+
+		err = t.check_participant_active(stub, tDoc.AddedBy)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = check_acting_participant(v, tDoc.AddedBy)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = t.check_document_responsibility(stub, v, tDoc)
+
+		if err != nil {
+			return nil, err
+		}
+
+		invoice, isInvoice, err := t.retrieve_summary_invoice(stub, tDoc.DocId)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if isInvoice {
+			err = cross_check_invoice(v.Goods, invoice)
+
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		v.Docs = append(v.Docs, tDoc)
-		add_trade_state(&v, WS_DOCS_UPLOADED)
+		previous := current_state(v)
+
+		now, err := tx_time(stub)
+
+		if err != nil {
+			return nil, err
+		}
+
+		add_trade_state(&v, WS_DOCS_UPLOADED, now)
 		_, err = t.save_trade(stub, v)
 
 		if err != nil {
-			fmt.Printf("add_docToTrade: Error saving changes: %s", err)
-			return nil, errors.New("add_docToTrade: Error saving changes")
+			fmt.Printf("add_doc_to_trade: Error saving changes: %s", err)
+			return nil, internal_error("add_doc_to_trade: Error saving changes", err)
 		}
-		return nil, nil
+		return nil, t.emit_event(stub, caller, "add_doc_to_trade", ET_TRADE, tradeId, previous, WS_DOCS_UPLOADED,
+			map[string]string{"docId": tDoc.DocId, "addedBy": tDoc.AddedBy})
 	}
 
 }
 
+func (sd SupportingDocument) validate() error {
+	v := new_validator()
+
+	v.nested("document", sd.Document.validate())
+
+	return v.result("SupportingDocument")
+}
+
 func (si SummaryInvoice) validate() error {
-	if si.DocId == "" || si.Description == "" || (si.CreateDTTM == time.Time{}) ||
-		si.ExtRefNum == "" || si.CreatedBy == "" || si.CreatedByType == "" || si.TotalAmount <= 0 {
+	v := new_validator()
 
-		fmt.Printf("CREATE_DOC: Null value provided for Document attribute(s)")
-		return errors.New("Null value provided for Document attribute(s)")
-	} else {
-		return nil
+	v.nested("document", si.Document.validate())
+	v.check("totalAmount", si.TotalAmount.isPositive(), "must be a positive amount in a supported currency")
+
+	total := zero_money(si.TotalAmount.Currency)
+	summed := true
+
+	for i, line := range si.Lines {
+		v.nested(index_field("lines", i), line.validate())
+
+		var err error
+
+		total, err = total.add(line.Amount)
+
+		if err != nil {
+			v.fail(index_field("lines", i)+".amount", "must be in "+si.TotalAmount.Currency)
+			summed = false
+		}
+	}
+
+	if len(si.Lines) > 0 && summed && total != si.TotalAmount {
+		v.fail("lines", "must add up to totalAmount")
 	}
+
+	return v.result("SummaryInvoice")
+}
+
+func (line InvoiceLine) validate() error {
+	v := new_validator()
+
+	v.positive("lineNum", int64(line.LineNum))
+	v.required("hsCode", line.HSCode)
+	v.format("hsCode", line.HSCode, is_valid_hs_code(line.HSCode), "6 to 10 digits")
+	v.text("description", line.Description, MAX_TEXT_LENGTH)
+	v.positive("quantity", line.Quantity)
+	v.required("unit", line.Unit)
+	v.check("amount", line.Amount.isPositive(), "must be a positive amount in a supported currency")
+
+	return v.result("InvoiceLine")
 }
 
 //==============================================================================================================================
@@ -641,7 +1078,7 @@ func (t *SimpleChaincode) create_participant(stub shim.ChaincodeStubInterface, c
 	participant, err := createParticipantFactory(participant_json, partyType)
 
 	if err != nil {
-		return nil, errors.New("Invalid JSON object provided for create_participant")
+		return nil, wrap_error(err, "Invalid JSON object provided for create_participant")
 	}
 
 	err = participant.validate()
@@ -650,23 +1087,64 @@ func (t *SimpleChaincode) create_participant(stub shim.ChaincodeStubInterface, c
 		return nil, err
 	}
 
+	if participant.getType() == PT_AUTHORITY {
+		err = t.check_authority_registration(stub, caller)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	record, err := stub.GetState(participant.getId()) // If not an error then a record exists so cant create a new participant with this participantId as it must be unique
 
 	if record != nil {
-		return nil, errors.New("Participant already exists")
+		return nil, conflict("Participant already exists")
+	}
+
+	party := participant.getParticipant()
+
+	err = t.validate_country(stub, party.Country)
+
+	if err != nil {
+		return nil, err
+	}
+
+	screening, err := t.screen(stub, caller, "create_participant", "",
+		[]ScreeningSubject{{SubjectId: party.ParticipantID, Name: party.PrimaryName, Country: t.country_code(stub, party.Country)}}, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if screening.Outcome == SO_BLOCKED {
+		logger.Warning("CREATE_PARTICIPANT: Participant " + party.ParticipantID + " blocked by screening " + screening.ScreeningId)
+		return json.Marshal(screening)
+	}
+
+	now, err := tx_time(stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	participant_json, err = set_participant_fields(participant_json, map[string]interface{}{
+		"status": PS_ACTIVE, "statusReason": "", "statusDTTM": now, "kyc": nil})
+
+	if err != nil {
+		return nil, invalid_argument("Invalid JSON object provided for create_participant", err)
 	}
 
 	_, err = t.save_participant(stub, participant_json, participant.getId())
 
 	if err != nil {
 		fmt.Printf("CREATE_PARTICIPANT: Error saving changes: %s", err)
-		return nil, errors.New("CREATE_PARTICIPANT: Error saving changes")
+		return nil, internal_error("CREATE_PARTICIPANT: Error saving changes", err)
 	}
 
 	bytes, err := stub.GetState(MK_PARTICIPANT)
 
 	if err != nil {
-		return nil, errors.New("func CREATE_PARTICIPANT(trade_json string) unable to get participantId")
+		return nil, internal_error("create_participant: Unable to get MK_PARTICIPANT", err)
 	}
 
 	var partyHolder Participant_Holder
@@ -674,7 +1152,7 @@ func (t *SimpleChaincode) create_participant(stub shim.ChaincodeStubInterface, c
 	err = json.Unmarshal(bytes, &partyHolder)
 
 	if err != nil {
-		return nil, errors.New("Corrupt Participant_Holder record")
+		return nil, internal_error("Corrupt Participant_Holder record", err)
 	}
 
 	partyHolder.ParticipantId = append(partyHolder.ParticipantId, participant.getId())
@@ -688,10 +1166,11 @@ func (t *SimpleChaincode) create_participant(stub shim.ChaincodeStubInterface, c
 	err = stub.PutState(MK_PARTICIPANT, bytes)
 
 	if err != nil {
-		return nil, errors.New("Unable to put the state Participant_Holder")
+		return nil, internal_error("Unable to put the state Participant_Holder", err)
 	}
 
-	return nil, nil
+	return nil, t.emit_event(stub, caller, "create_participant", ET_PARTICIPANT, participant.getId(), "", PS_ACTIVE,
+		map[string]string{"type": participant.getType()})
 }
 
 // save_participant - Writes to the ledger the Participant struct passed in a JSON format. Uses the shim file's
@@ -702,25 +1181,25 @@ func (t *SimpleChaincode) save_participant(stub shim.ChaincodeStubInterface, par
 	//
 	//	if err != nil {
 	//		fmt.Printf("SAVE_PARTY: Error converting participant record: %s", err)
-	//		return false, errors.New("SAVE_PARTY: Error converting participant record")
+	//		return false, internal_error("SAVE_PARTY: Error converting participant record", err)
 	//	}
 
 	err := stub.PutState(partyId, partyJson)
 
 	if err != nil {
 		fmt.Printf("SAVE_PARTY: Error storing participant record: %s", err)
-		return false, errors.New("SAVE_PARTY: Error storing participant record")
+		return false, internal_error("SAVE_PARTY: Error storing participant record", err)
 	}
 
 	return true, nil
 }
 
-//	 get_participants
+//	 get_participants - Every participant, with KYC profiles shown only to the participant itself, authorities and banks
 func (t *SimpleChaincode) get_participants(stub shim.ChaincodeStubInterface, caller string, caller_affiliation string) ([]byte, error) {
 	bytes, err := stub.GetState(MK_PARTICIPANT)
 
 	if err != nil {
-		return nil, errors.New("Unable to get MK_PARTICIPANT")
+		return nil, internal_error("Unable to get MK_PARTICIPANT", err)
 	}
 
 	var participants Participant_Holder
@@ -728,7 +1207,7 @@ func (t *SimpleChaincode) get_participants(stub shim.ChaincodeStubInterface, cal
 	err = json.Unmarshal(bytes, &participants)
 
 	if err != nil {
-		return nil, errors.New("Corrupt Participant_Holder")
+		return nil, internal_error("Corrupt Participant_Holder", err)
 	}
 
 	result := "["
@@ -740,7 +1219,13 @@ func (t *SimpleChaincode) get_participants(stub shim.ChaincodeStubInterface, cal
 		temp, err = t.retrieve_participant(stub, participantsId)
 
 		if err != nil {
-			return nil, errors.New("Failed to retrieve Participant")
+			return nil, wrap_error(err, "Failed to retrieve Participant")
+		}
+
+		temp, err = t.participant_view(stub, caller, participantsId, temp)
+
+		if err != nil {
+			return nil, err
 		}
 
 		//		temp, err = t.get_participant_details(stub, v, caller, caller_affiliation)
@@ -768,25 +1253,65 @@ func (t *SimpleChaincode) retrieve_participant(stub shim.ChaincodeStubInterface,
 
 	if err != nil {
 		fmt.Printf("retrieve_participant: Failed to invoke participantId: %s", err)
-		return nil, errors.New("retrieve_participant: Error participantId trade with ID = " + participantId)
+		return nil, internal_error("retrieve_participant: Error retrieving participant with ID = "+participantId, err)
 	}
 
 	return bytes, nil
 }
 
+//	 retrieve_participant_record - As retrieve_participant but returns the parsed Participant
+func (t *SimpleChaincode) retrieve_participant_record(stub shim.ChaincodeStubInterface, participantId string) (Participant, error) {
+
+	var party Participant
+
+	bytes, err := t.retrieve_participant(stub, participantId)
+
+	if err != nil {
+		return party, err
+	}
+
+	if bytes == nil {
+		return party, not_found("retrieve_participant: Participant " + participantId + " does not exist")
+	}
+
+	err = json.Unmarshal(bytes, &party)
+
+	if err != nil {
+		return party, internal_error("retrieve_participant: Corrupt participant record "+participantId, err)
+	}
+
+	return party, nil
+}
+
 func (t *SimpleChaincode) add_participant_to_trade(stub shim.ChaincodeStubInterface,
 	caller string, caller_affiliation string, json_data []byte, tradeId string) ([]byte, error) {
 	v, err := t.retrieve_trade(stub, tradeId)
 
 	if err != nil {
-		return nil, errors.New("add_participant_to_trade: Failed to retrieve Trade")
+		return nil, wrap_error(err, "add_participant_to_trade: Failed to retrieve Trade")
 	} else {
 		var tParticipant TradeParticipant
 
 		err = json.Unmarshal(json_data, &tParticipant)
 
 		if err != nil {
-			return nil, errors.New("Corrupt TradeParticipant JSON received")
+			return nil, invalid_argument("Corrupt TradeParticipant JSON received", err)
+		}
+
+		err = check_not_on_hold(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tParticipant, screening, err := t.invite_participant(stub, caller, "add_participant_to_trade", v, tParticipant)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if screening.Outcome == SO_BLOCKED {
+			return json.Marshal(screening)
 		}
 
 		v.Participants = append(v.Participants, tParticipant)
@@ -794,19 +1319,18 @@ func (t *SimpleChaincode) add_participant_to_trade(stub shim.ChaincodeStubInterf
 
 		if err != nil {
 			fmt.Printf("add_participant_to_trade: Error saving changes: %s", err)
-			return nil, errors.New("add_participant_to_trade: Error saving changes")
+			return nil, internal_error("add_participant_to_trade: Error saving changes", err)
 		}
-		return nil, nil
-	}
-}
 
-//=================================================================================================================================
-//	 Ping Function
-//=================================================================================================================================
-//	 Pings the peer to keep the connection alive
-//=================================================================================================================================
-func (t *SimpleChaincode) ping(stub shim.ChaincodeStubInterface) ([]byte, error) {
-	return []byte("Hello, world!"), nil
+		err = t.index_participant_trade(stub, tradeId, tParticipant)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, t.emit_event(stub, caller, "add_participant_to_trade", ET_TRADE, tradeId, "", tParticipant.Status,
+			map[string]string{"participantId": tParticipant.ParticipantID, "relationshipType": tParticipant.RelationshipType})
+	}
 }
 
 //==============================================================================================================================
@@ -815,15 +1339,15 @@ func (t *SimpleChaincode) ping(stub shim.ChaincodeStubInterface) ([]byte, error)
 func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
 	fmt.Printf("\nSUSH: In Init method of chaincode...")
 	//Args
-	//				0
-	//			peer_address
+	//				0					1
+	//			peer_address	first authority (base64 JSON)
 
 	var trades Trade_Holder
 
 	bytes, err := json.Marshal(trades)
 
 	if err != nil {
-		return nil, errors.New("Error creating Trade_Holder record")
+		return nil, internal_error("Error creating Trade_Holder record", err)
 	}
 
 	err = stub.PutState(MK_TRADE, bytes)
@@ -834,7 +1358,7 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface, function string
 	bytes, err = json.Marshal(docs)
 
 	if err != nil {
-		return nil, errors.New("Error creating Document_Holder record")
+		return nil, internal_error("Error creating Document_Holder record", err)
 	}
 
 	err = stub.PutState(MK_DOCUMENT, bytes)
@@ -845,74 +1369,87 @@ func (t *SimpleChaincode) Init(stub shim.ChaincodeStubInterface, function string
 	bytes, err = json.Marshal(participants)
 
 	if err != nil {
-		return nil, errors.New("Error creating Participant_Holder record")
+		return nil, internal_error("Error creating Participant_Holder record", err)
 	}
 
 	err = stub.PutState(MK_PARTICIPANT, bytes)
 
-	return nil, nil
+	//Country registry seeded with the legacy CT_* countries
+	_, err = t.migrate_legacy_countries(stub, "", "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	//The first authority, every later one is registered by an existing authority
+	if len(args) < 2 {
+		return nil, invalid_argument("Init: The first authority must be given as the second argument", nil)
+	}
+
+	authority_json, err := decodeBase64(args[1])
+
+	if err != nil {
+		return nil, invalid_argument("Init: The first authority is not base64 encoded", err)
+	}
+
+	return nil, t.seed_authority(stub, authority_json)
 }
 
 //=================================================================================================================================
 //	Query - Called on chaincode query. Takes a function name passed and calls that function. Passes the
 //  		initial arguments passed are passed on to the called function.
+//			Only READ handlers in router.go can be queried.
+//			Errors are returned as the JSON envelope described in errors.go.
 //=================================================================================================================================
 func (t *SimpleChaincode) Query(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
 	caller, caller_affiliation, err := t.get_caller_data(stub)
 	if err != nil {
 		fmt.Printf("QUERY: Error retrieving caller details", err)
-		return nil, errors.New("QUERY: Error retrieving caller details: " + err.Error())
+		return nil, error_envelope(function, wrap_error(err, "QUERY: Error retrieving caller details"))
 	}
 
 	logger.Debug("function: ", function)
 	logger.Debug("caller: ", caller)
 	logger.Debug("affiliation: ", caller_affiliation)
 
-	if function == "get_trades" {
-		return t.get_trades(stub, caller, caller_affiliation)
-	} else if function == "get_participants" {
-		return t.get_participants(stub, caller, caller_affiliation)
-	} else if function == "get_documents" {
-		return t.get_documents(stub, caller, caller_affiliation)
-	}
+	result, err := t.dispatch(stub, caller, caller_affiliation, function, args, true)
 
-	return nil, errors.New("Received unknown function invocation " + function)
+	if err != nil {
+		return nil, error_envelope(function, err)
+	}
 
+	return result, nil
 }
 
 //==============================================================================================================================
 //	 Router Functions
 //==============================================================================================================================
-//	Invoke - Called on chaincode invoke. Takes a function name passed and calls that function. Converts some
-//		  initial arguments passed to other things for use in the called function e.g. name -> ecert
+//	Invoke - Called on chaincode invoke. Takes a function name passed and calls that function. Decodes the
+//		  arguments as declared by its handler in router.go e.g. base64 payload -> JSON
+//		  Callers that are not identified are refused.
+//		  Errors are returned as the JSON envelope described in errors.go.
 //==============================================================================================================================
 func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function string, args []string) ([]byte, error) {
 	caller, caller_affiliation, err := t.get_caller_data(stub)
 
-	arg0, err := decodeBase64(args[0])
-	logger.Debug("Undecoded payload = " + args[0])
+	logger.Debug("function: ", function)
+	logger.Debug("caller: ", caller)
 
-	if err != nil {
-		logger.Debug("Error = " + err.Error())
-		return nil, errors.New("Error retrieving caller information")
+	if caller == "" {
+		return nil, error_envelope(function, permission_denied("Invoke: Caller is not identified, the certificate has no username attribute"))
+	}
+
+	result, err := t.dispatch(stub, caller, caller_affiliation, function, args, false)
+
+	if err == nil {
+		err = t.record_audit(stub, caller, function, args, result)
 	}
 
-	if function == "create_trade" {
-		return t.create_trade(stub, caller, caller_affiliation, arg0)
-	} else if function == "create_document" {
-		return t.create_document(stub, caller, caller_affiliation, arg0, args[1])
-	} else if function == "create_participant" {
-		return t.create_participant(stub, caller, caller_affiliation, arg0, args[1])
-	} else if function == "add_doc_to_trade" {
-		return t.add_doc_to_trade(stub, caller, caller_affiliation, arg0, args[1])
-	} else if function == "add_participant_to_trade" {
-		return t.add_participant_to_trade(stub, caller, caller_affiliation, arg0, args[1])
-	} else if function == "add_trade_state" {
-		return t.add_trade_state(stub, caller, caller_affiliation, args[0], args[1])
-	} else if function == "ping" {
-		return t.ping(stub)
+	if err != nil {
+		return nil, error_envelope(function, err)
 	}
-	return nil, errors.New("Function by name " + function + " doesn't exist.")
+
+	return result, nil
 }
 
 //==============================================================================================================================
@@ -922,16 +1459,43 @@ func (t *SimpleChaincode) Invoke(stub shim.ChaincodeStubInterface, function stri
 
 func (t *SimpleChaincode) get_caller_data(stub shim.ChaincodeStubInterface) (string, string, error) {
 
-	//	user, err := t.get_username(stub)
-	//
-	//	affiliation, err := t.check_affiliation(stub)
-	//
-	//	if err != nil {
-	//		return "", "", err
-	//	}
-	//
-	//	return user, affiliation, nil
-	return "", "", nil
+	user, err := t.get_username(stub)
+
+	if err != nil {
+		// Certificates issued without attributes are anonymous. Invoke refuses them; queries get least privilege.
+		return "", "", nil
+	}
+
+	affiliation, err := t.check_affiliation(stub)
+
+	if err != nil {
+		return user, "", nil
+	}
+
+	return user, affiliation, nil
+}
+
+//==============================================================================================================================
+//	 check_caller_type - The caller's username must be the ID of a registered participant of the given type.
+//==============================================================================================================================
+
+func (t *SimpleChaincode) check_caller_type(stub shim.ChaincodeStubInterface, caller string, partyType string) error {
+
+	if caller == "" {
+		return permission_denied("Caller is not identified")
+	}
+
+	party, err := t.retrieve_participant_record(stub, caller)
+
+	if err != nil {
+		return permission_denied("Caller " + caller + " is not a registered participant")
+	}
+
+	if party.Type != partyType {
+		return permission_denied("Caller " + caller + " is not a participant of type " + partyType)
+	}
+
+	return nil
 }
 
 //==============================================================================================================================
@@ -943,7 +1507,7 @@ func (t *SimpleChaincode) get_username(stub shim.ChaincodeStubInterface) (string
 
 	username, err := stub.ReadCertAttribute("username")
 	if err != nil {
-		return "", errors.New("Couldn't get attribute 'username'. Error: " + err.Error())
+		return "", internal_error("Couldn't get attribute 'username'", err)
 	}
 	return string(username), nil
 }
@@ -956,7 +1520,7 @@ func (t *SimpleChaincode) get_username(stub shim.ChaincodeStubInterface) (string
 func (t *SimpleChaincode) check_affiliation(stub shim.ChaincodeStubInterface) (string, error) {
 	affiliation, err := stub.ReadCertAttribute("role")
 	if err != nil {
-		return "", errors.New("Couldn't get attribute 'role'. Error: " + err.Error())
+		return "", internal_error("Couldn't get attribute 'role'", err)
 	}
 	return string(affiliation), nil
 
@@ -965,26 +1529,94 @@ func (t *SimpleChaincode) check_affiliation(stub shim.ChaincodeStubInterface) (s
 //==============================================================================================================================
 //	 Global Methods
 //==============================================================================================================================
-func add_trade_state(trade *Trade, state string) (*Trade, error) {
+func add_trade_state(trade *Trade, state string, now time.Time) (*Trade, error) {
 	var ts TradeState
 	ts.State = state
-	ts.StateDTTM = time.Now()
+	ts.StateDTTM = now
 	trade.States = append(trade.States, ts)
 	return trade, nil
 }
 
+//	 get_holder - Reads a global holder record. A holder that has never been written is returned empty.
+func (t *SimpleChaincode) get_holder(stub shim.ChaincodeStubInterface, key string, holder interface{}) error {
+
+	bytes, err := stub.GetState(key)
+
+	if err != nil {
+		return internal_error("Unable to get "+key, err)
+	}
+
+	if bytes == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(bytes, holder)
+
+	if err != nil {
+		return internal_error("Corrupt holder record "+key, err)
+	}
+
+	return nil
+}
+
+func (t *SimpleChaincode) put_holder(stub shim.ChaincodeStubInterface, key string, holder interface{}) error {
+
+	bytes, err := json.Marshal(holder)
+
+	if err != nil {
+		return internal_error("Error creating holder record "+key, err)
+	}
+
+	err = stub.PutState(key, bytes)
+
+	if err != nil {
+		return internal_error("Unable to put the state "+key, err)
+	}
+
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(list []string, value string) []string {
+	result := make([]string, 0, len(list))
+	for _, v := range list {
+		if v != value {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 func createDocument(document_json []byte, docType string) (DocumentInt, error) {
 	switch docType {
 	case DT_SMRY_INVOICE:
 		var sInv SummaryInvoice
 		err := json.Unmarshal(document_json, &sInv) // Convert the JSON defined above into a SummaryInvoice object for go
 		if err != nil {
-			return nil, errors.New("createDocument: Incorrect JSON " + err.Error())
+			return nil, invalid_argument("createDocument: Incorrect JSON", err)
 		} else {
 			return sInv, nil
 		}
+	case DT_EXPORT_DECL, DT_IMPORT_DECL, DT_BILL_OF_LADING, DT_INSURANCE_CERT, DT_PACKING_LIST, DT_CERT_ORIGIN:
+		var sDoc SupportingDocument
+		err := json.Unmarshal(document_json, &sDoc) // Convert the JSON defined above into a SupportingDocument object for go
+		if err != nil {
+			return nil, invalid_argument("createDocument: Incorrect JSON", err)
+		} else if sDoc.Type != docType {
+			return nil, invalid_argument("createDocument: Document type does not match "+docType, nil)
+		} else {
+			return sDoc, nil
+		}
 	default:
-		return nil, errors.New("createDocument: Unknown document type specified")
+		return nil, invalid_argument("createDocument: Unknown document type "+docType, nil)
 
 	}
 }
@@ -995,7 +1627,7 @@ func createParticipantFactory(participant_json []byte, partyType string) (Partic
 		var bnk Bank
 		err := json.Unmarshal(participant_json, &bnk) // Convert the JSON defined above into a Bank object for go
 		if err != nil {
-			return nil, errors.New("Error unmarshalling Participant Bank" + err.Error())
+			return nil, invalid_argument("Error unmarshalling Participant Bank", err)
 		} else {
 			return bnk, nil
 		}
@@ -1003,7 +1635,7 @@ func createParticipantFactory(participant_json []byte, partyType string) (Partic
 		var cstm Customs
 		err := json.Unmarshal([]byte(participant_json), &cstm) // Convert the JSON defined above into a Customs object for go
 		if err != nil {
-			return nil, errors.New("Error unmarshalling Participant Customs" + err.Error())
+			return nil, invalid_argument("Error unmarshalling Participant Customs", err)
 		} else {
 			return cstm, nil
 		}
@@ -1011,20 +1643,28 @@ func createParticipantFactory(participant_json []byte, partyType string) (Partic
 		var prt Port
 		err := json.Unmarshal([]byte(participant_json), &prt) // Convert the JSON defined above into a Port object for go
 		if err != nil {
-			return nil, errors.New("Error unmarshalling Participant Port" + err.Error())
+			return nil, invalid_argument("Error unmarshalling Participant Port", err)
 		} else {
 			return prt, nil
 		}
+	case PT_AUTHORITY:
+		var auth Authority
+		err := json.Unmarshal([]byte(participant_json), &auth) // Convert the JSON defined above into an Authority object for go
+		if err != nil {
+			return nil, invalid_argument("Error unmarshalling Participant Authority", err)
+		} else {
+			return auth, nil
+		}
 	case PT_TRADER:
 		var trd Trader
 		err := json.Unmarshal([]byte(participant_json), &trd) // Convert the JSON defined above into a Trader object for go
 		if err != nil {
-			return nil, errors.New("Error unmarshalling Participant Trader" + err.Error())
+			return nil, invalid_argument("Error unmarshalling Participant Trader", err)
 		} else {
 			return trd, nil
 		}
 	default:
-		return nil, errors.New("Unknown participant type specified")
+		return nil, invalid_argument("Unknown participant type "+partyType, nil)
 	}
 }
 
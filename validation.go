@@ -0,0 +1,168 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//==============================================================================================================================
+//	 Constants
+//==============================================================================================================================
+//Field lengths
+const MAX_ID_LENGTH = 64
+const MAX_NAME_LENGTH = 256
+const MAX_TEXT_LENGTH = 1024
+
+//Validation reasons
+const VR_REQUIRED = "is required"
+const VR_POSITIVE = "must be positive"
+const VR_NOT_UPDATABLE = "cannot be updated"
+
+//Allowed values
+var participantTypes = []string{PT_AUTHORITY, PT_TRADER, PT_PORT, PT_CUSTOMS, PT_BANK}
+
+var relationshipTypes = []string{TR_AUTHORITY, TR_IMP_BANK, TR_EXP_BANK, TR_IMPORTER, TR_EXPORTER, TR_DEST_PORT,
+	TR_ORGN_PORT, TR_TRNST_PORT, TR_SRC_CUSTOMS, TR_DST_CUSTOMS}
+
+var tradeStates = []string{WS_CARGO_ENROUTE, WS_DOCS_UPLOADED, WS_TRADE_DECLARED, WS_TRADE_CLEARED, WS_CARGO_ARRIVED,
+	WS_CARGO_RELEASED}
+
+var documentTypes = []string{DT_SMRY_INVOICE, DT_EXPORT_DECL, DT_IMPORT_DECL, DT_BILL_OF_LADING, DT_INSURANCE_CERT,
+	DT_PACKING_LIST, DT_CERT_ORIGIN}
+
+//==============================================================================================================================
+//	 Structure Definitions
+//==============================================================================================================================
+//	Validator - Runs every rule on a payload and collects each failing field rather than stopping at the first.
+//				Fields are named by their JSON path, e.g. "goods[1].hsCode", so clients can point at the input.
+//==============================================================================================================================
+type Validator struct {
+	Fields []FieldError
+}
+
+func new_validator() *Validator {
+	return &Validator{}
+}
+
+//==============================================================================================================================
+//	 Rules
+//==============================================================================================================================
+func (v *Validator) fail(field string, reason string) {
+	v.Fields = append(v.Fields, FieldError{Field: field, Reason: reason})
+}
+
+func (v *Validator) check(field string, ok bool, reason string) {
+	if !ok {
+		v.fail(field, reason)
+	}
+}
+
+func (v *Validator) required(field string, value string) {
+	v.check(field, strings.TrimSpace(value) != "", VR_REQUIRED)
+}
+
+func (v *Validator) required_time(field string, value time.Time) {
+	v.check(field, !value.IsZero(), VR_REQUIRED)
+}
+
+func (v *Validator) positive(field string, value int64) {
+	v.check(field, value > 0, VR_POSITIVE)
+}
+
+func (v *Validator) max_length(field string, value string, max int) {
+	v.check(field, len(value) <= max, "must be at most "+strconv.Itoa(max)+" characters")
+}
+
+//	 text - Required, and no longer than max
+func (v *Validator) text(field string, value string, max int) {
+	v.required(field, value)
+	v.max_length(field, value, max)
+}
+
+//	 identifier - Required, short, and without spaces or control characters as it is used in ledger keys
+func (v *Validator) identifier(field string, value string) {
+	v.text(field, value, MAX_ID_LENGTH)
+	v.format(field, value, is_identifier(value), "free of spaces and control characters")
+}
+
+//	 format - Checks a value that has been given; a missing value is left to required
+func (v *Validator) format(field string, value string, valid bool, format string) {
+	if value != "" && !valid {
+		v.fail(field, "must be "+format)
+	}
+}
+
+//	 one_of - Checks a value that has been given against the allowed values
+func (v *Validator) one_of(field string, value string, allowed ...string) {
+	if value != "" && !contains(allowed, value) {
+		v.fail(field, "must be one of "+strings.Join(allowed, ", "))
+	}
+}
+
+//	 ordered - The later time must be after the earlier one. Times not given are left to required.
+func (v *Validator) ordered(earlierField string, earlier time.Time, laterField string, later time.Time) {
+	if !earlier.IsZero() && !later.IsZero() && !later.After(earlier) {
+		v.fail(laterField, "must be after "+earlierField)
+	}
+}
+
+//	 paging - Offset and page size of a paged query; a page size of 0 takes the default
+func (v *Validator) paging(offset int, pageSize int) {
+	v.check("offset", offset >= 0, "must not be negative")
+	v.check("pageSize", pageSize >= 0 && pageSize <= MAX_PAGE_SIZE, "must be between 0 and "+strconv.Itoa(MAX_PAGE_SIZE))
+}
+
+//	 nested - Adds the failures of a nested entity's validate under field. An error without field details is
+//			  reported against field itself.
+func (v *Validator) nested(field string, err error) {
+	if err == nil {
+		return
+	}
+
+	fields := error_fields(err)
+
+	if len(fields) == 0 {
+		v.fail(field, err.Error())
+		return
+	}
+
+	for _, f := range fields {
+		if field != "" {
+			f.Field = field + "." + f.Field
+		}
+		v.Fields = append(v.Fields, f)
+	}
+}
+
+//	 result - nil when every rule passed, otherwise a validation error listing each failing field
+func (v *Validator) result(entity string) error {
+	if len(v.Fields) == 0 {
+		return nil
+	}
+
+	var reasons []string
+
+	for _, f := range v.Fields {
+		reasons = append(reasons, f.Field+" "+f.Reason)
+	}
+
+	return validation_error(entity+" failed validation: "+strings.Join(reasons, "; "), v.Fields...)
+}
+
+//==============================================================================================================================
+//	 Global Methods
+//==============================================================================================================================
+func index_field(name string, i int) string {
+	return name + "[" + strconv.Itoa(i) + "]"
+}
+
+func is_identifier(s string) bool {
+	for _, r := range s {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return false
+		}
+	}
+	return true
+}